@@ -0,0 +1,124 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Nodes can carry named numeric attributes besides cash, such as
+// hours, CO2 or a satisfaction score.  Like cash, an attribute is per
+// period, is summed along the path in Forward and rolled up by
+// probability in Backward:
+//
+//	criteria:
+//	  npv: 1e-6
+//	  co2: -0.5
+//	  satisfaction: 2
+//	retrofit:
+//	  cash: -2M
+//	  days: 180
+//	  attrs:
+//	    co2: -300
+//	    satisfaction: 4
+//
+// The model-level `criteria:` section gives a weight for each
+// attribute, or for the built-in `cash`, `npv` and `days`, and each
+// Stats gets a Score, the weighted sum.  The weights have to take
+// care of the different units.
+
+// evalAttrs sets the node's period and node attributes.
+func (a *Ast) evalAttrs(vars Vars) (err error) {
+	a.Period.Attrs = nil
+	a.Node.Attrs = nil
+	for name, expr := range a.src.Attrs {
+		if !identRe.MatchString(name) {
+			return fmt.Errorf("attrs: invalid name: %q", name)
+		}
+		var v float64
+		v, err = evalAmount(expr, vars)
+		if err != nil {
+			return fmt.Errorf("attrs: %s: %v", name, err)
+		}
+		a.Period.Attrs = addAttrs(a.Period.Attrs, map[string]float64{name: v}, 1)
+		a.Node.Attrs = addAttrs(a.Node.Attrs, map[string]float64{name: v}, float64(a.Repeat))
+	}
+	return
+}
+
+// addAttrs adds src, scaled, to dst, and returns dst.  dst is
+// allocated if need be.
+func addAttrs(dst, src map[string]float64, scale float64) map[string]float64 {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]float64, len(src))
+	}
+	for name, v := range src {
+		dst[name] += v * scale
+	}
+	return dst
+}
+
+// copyAttrs returns a copy of attrs.
+func copyAttrs(attrs map[string]float64) map[string]float64 {
+	return addAttrs(nil, attrs, 1)
+}
+
+// attrNames returns the sorted names of the attributes in stats.
+func attrNames(stats ...Stats) (names []string) {
+	seen := make(map[string]bool)
+	for _, s := range stats {
+		for name := range s.Attrs {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// resolveCriteria evaluates the criteria weights.
+func (m *Model) resolveCriteria() (err error) {
+	m.criteria = nil
+	for name, expr := range m.Criteria {
+		if !identRe.MatchString(name) {
+			return fmt.Errorf("criteria: invalid name: %q", name)
+		}
+		var w float64
+		w, err = evalFloat(expr, m.vars)
+		if err != nil {
+			return fmt.Errorf("criteria: %s: %v", name, err)
+		}
+		if m.criteria == nil {
+			m.criteria = make(map[string]float64)
+		}
+		m.criteria[name] = w
+	}
+	return
+}
+
+// score returns the weighted sum of the criteria in s.
+func (m *Model) score(s Stats) (score float64) {
+	if m == nil {
+		return
+	}
+	for name, w := range m.criteria {
+		var v float64
+		switch name {
+		case "cash":
+			v = s.Cash
+		case "npv":
+			v = s.Npv
+		case "days":
+			v = float64(s.Duration) / float64(24*time.Hour)
+		default:
+			v = s.Attrs[name]
+		}
+		score += w * v
+	}
+	return
+}
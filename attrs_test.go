@@ -0,0 +1,58 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestAttrs(t *testing.T) {
+	buf := []byte(`
+criteria:
+  cash: 1e-3
+  co2: -2
+  hours: -0.1
+choose:
+  attrs:
+    hours: 10
+  paths:
+    retrofit: .5
+    replace: .5
+retrofit:
+  cash: -20k
+  days: 30
+  repeat: 2
+  attrs:
+    hours: 40
+    co2: -5
+replace:
+  cash: -50k
+  attrs:
+    co2: -30
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	root := roots[0]
+	replace, retrofit := root.Hyperedges[0].Children[0], root.Hyperedges[1].Children[0]
+	Tassert(t, retrofit.Node.Attrs["hours"] == 80, "retrofit hours %v", retrofit.Node.Attrs["hours"])
+	Tassert(t, retrofit.Path.Attrs["hours"] == 90, "retrofit path hours %v", retrofit.Path.Attrs["hours"])
+	Tassert(t, retrofit.Path.Attrs["co2"] == -10, "retrofit path co2 %v", retrofit.Path.Attrs["co2"])
+	Tassert(t, replace.Path.Attrs["hours"] == 10, "replace path hours %v", replace.Path.Attrs["hours"])
+	Tassert(t, root.Path.Attrs["co2"] == 0, "root attrs modified: %v", root.Path.Attrs)
+
+	Tassert(t, root.Expected.Attrs["co2"] == -20, "expected co2 %v", root.Expected.Attrs["co2"])
+	Tassert(t, root.Expected.Attrs["hours"] == 50, "expected hours %v", root.Expected.Attrs["hours"])
+	// retrofit: -40 + 20 - 9 = -29, replace: -50 + 60 - 1 = 9
+	Tassert(t, math.Abs(retrofit.Expected.Score+29) < 1e-9, "retrofit score %v", retrofit.Expected.Score)
+	Tassert(t, math.Abs(replace.Expected.Score-9) < 1e-9, "replace score %v", replace.Expected.Score)
+	Tassert(t, math.Abs(root.Expected.Score+10) < 1e-9, "root score %v", root.Expected.Score)
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, "co2|hours|score"), "missing attr columns in dot")
+}
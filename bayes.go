@@ -0,0 +1,222 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// A test is an imperfect observation of an uncertainty, such as a
+// pilot or a market survey.  It is declared in the model-level
+// `tests:` section with the likelihood of each signal given each
+// outcome of the uncertainty, P(signal | outcome):
+//
+//	uncertainties:
+//	  market: {good: .4, bad: rest}
+//	tests:
+//	  pilot:
+//	    of: market
+//	    signals:
+//	      positive: {good: .8, bad: .3}
+//	      negative: {good: .2, bad: .7}
+//
+// Path probabilities can then refer to the chance of a signal,
+// `pilot.positive`, and to the posterior of an outcome after one or
+// more signals, `market.good | pilot.positive`; the tool works out
+// Bayes' rule.  Signals can condition on other signals too, e.g.
+// `survey.yes | pilot.positive`, and several tests of the same
+// uncertainty are taken to be independent given its outcome:
+//
+//	pilot:
+//	  cash: -50k
+//	  paths:
+//	    build-after-positive: pilot.positive
+//	    stop: pilot.negative
+//	build-after-positive:
+//	  paths:
+//	    good-market: market.good | pilot.positive
+//	    bad-market: market.bad | pilot.positive
+type Test struct {
+	Of      string
+	Signals map[string]map[string]string
+}
+
+// event is an outcome of an uncertainty, or a signal of a test.
+type event struct {
+	name    string
+	outcome string
+}
+
+func (e event) String() string {
+	return e.name + "." + e.outcome
+}
+
+// eventResolver turns references to outcomes and signals into
+// probability expressions.
+type eventResolver struct {
+	uncertainties map[string]Uncertainty
+	priors        map[string]map[string]string
+	tests         map[string]Test
+}
+
+// newEventResolver checks the model-level uncertainties and tests.
+func (m *Model) newEventResolver() (r *eventResolver, err error) {
+	r = &eventResolver{
+		uncertainties: make(map[string]Uncertainty),
+		priors:        make(map[string]map[string]string),
+		tests:         make(map[string]Test),
+	}
+	for _, u := range m.Uncertainties {
+		if _, ok := r.uncertainties[u.Name]; ok {
+			return nil, fmt.Errorf("uncertainties: duplicate uncertainty: %s", u.Name)
+		}
+		var p []string
+		p, err = u.check()
+		if err != nil {
+			return nil, fmt.Errorf("uncertainties: %v", err)
+		}
+		r.uncertainties[u.Name] = u
+		r.priors[u.Name] = make(map[string]string)
+		for i, o := range u.Outcomes {
+			r.priors[u.Name][o.Name] = p[i]
+		}
+	}
+	for name, test := range m.Tests {
+		err = r.checkTest(name, test, m.vars)
+		if err != nil {
+			return nil, fmt.Errorf("tests: %s: %v", name, err)
+		}
+		r.tests[name] = test
+	}
+	return
+}
+
+// checkTest makes sure the test gives a likelihood for every outcome
+// of its uncertainty, and that they add up to 1 over the signals.
+func (r *eventResolver) checkTest(name string, test Test, vars Vars) (err error) {
+	if !identRe.MatchString(name) {
+		return fmt.Errorf("invalid name")
+	}
+	if _, ok := r.uncertainties[name]; ok {
+		return fmt.Errorf("is also an uncertainty")
+	}
+	u, ok := r.uncertainties[test.Of]
+	if !ok {
+		return fmt.Errorf("of: no such uncertainty: %q", test.Of)
+	}
+	if len(test.Signals) == 0 {
+		return fmt.Errorf("no signals")
+	}
+	sums := make(map[string]float64)
+	for signal, likelihoods := range test.Signals {
+		if !identRe.MatchString(signal) {
+			return fmt.Errorf("invalid signal: %q", signal)
+		}
+		for state := range likelihoods {
+			if _, ok := r.priors[u.Name][state]; !ok {
+				return fmt.Errorf("%s: %s has no outcome %s", signal, u.Name, state)
+			}
+		}
+		for _, o := range u.Outcomes {
+			expr, ok := likelihoods[o.Name]
+			if !ok {
+				return fmt.Errorf("%s: missing likelihood for %s", signal, o.Name)
+			}
+			var p float64
+			p, err = evalFloat(expr, vars)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %v", signal, o.Name, err)
+			}
+			sums[o.Name] += p
+		}
+	}
+	for _, o := range u.Outcomes {
+		if math.Abs(sums[o.Name]-1) > .001 {
+			return fmt.Errorf("likelihoods given %s add up to %v, not 1", o.Name, sums[o.Name])
+		}
+	}
+	return
+}
+
+// names returns the names that can be referred to.
+func (r *eventResolver) names() (names []string) {
+	for name := range r.uncertainties {
+		names = append(names, name)
+	}
+	for name := range r.tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// about returns the uncertainty an event is about.
+func (r *eventResolver) about(e event) (u Uncertainty, err error) {
+	if test, ok := r.tests[e.name]; ok {
+		if _, ok := test.Signals[e.outcome]; !ok {
+			err = fmt.Errorf("%s has no signal %s", e.name, e.outcome)
+		}
+		return r.uncertainties[test.Of], err
+	}
+	u = r.uncertainties[e.name]
+	if _, ok := r.priors[e.name][e.outcome]; !ok {
+		err = fmt.Errorf("%s has no outcome %s", e.name, e.outcome)
+	}
+	return
+}
+
+// prob returns an expression for P(e | given...).
+func (r *eventResolver) prob(e event, given []event) (expr string, err error) {
+	joint, err := r.joint(append([]event{e}, given...))
+	if err != nil || len(given) == 0 {
+		return joint, err
+	}
+	marginal, err := r.joint(given)
+	if err != nil {
+		return
+	}
+	return Spf("(%s) / (%s)", joint, marginal), nil
+}
+
+// joint returns an expression for the probability that all of the
+// events happen: the sum over the outcomes they allow of the prior
+// times the likelihood of each signal.
+func (r *eventResolver) joint(events []event) (expr string, err error) {
+	var u Uncertainty
+	var state string
+	for i, e := range events {
+		var about Uncertainty
+		about, err = r.about(e)
+		if err != nil {
+			return
+		}
+		if i > 0 && about.Name != u.Name {
+			return "", fmt.Errorf("%s and %s are about different uncertainties", events[0], e)
+		}
+		u = about
+		if e.name != u.Name {
+			continue
+		}
+		if state != "" && state != e.outcome {
+			return "0", nil
+		}
+		state = e.outcome
+	}
+	var terms []string
+	for _, o := range u.Outcomes {
+		if state != "" && o.Name != state {
+			continue
+		}
+		factors := []string{r.priors[u.Name][o.Name]}
+		for _, e := range events {
+			if test, ok := r.tests[e.name]; ok {
+				factors = append(factors, "("+test.Signals[e.outcome][o.Name]+")")
+			}
+		}
+		terms = append(terms, strings.Join(factors, " * "))
+	}
+	return strings.Join(terms, " + "), nil
+}
@@ -0,0 +1,96 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestBayes(t *testing.T) {
+	buf := []byte(`
+uncertainties:
+  market: {good: .4, bad: rest}
+tests:
+  pilot:
+    of: market
+    signals:
+      positive: {good: .8, bad: .3}
+      negative: {good: .2, bad: .7}
+  survey:
+    of: market
+    signals:
+      yes: {good: .9, bad: .2}
+      no: {good: .1, bad: .8}
+pilot:
+  paths:
+    after-positive: pilot.positive
+    after-negative: pilot.negative
+after-positive:
+  paths:
+    good: market.good | pilot.positive
+    bad: market.bad | pilot.positive
+after-negative:
+  paths:
+    good: market.good | pilot.negative
+    bad: rest
+survey:
+  paths:
+    survey-yes: survey.yes | pilot.positive
+    bad: survey.no | pilot.positive
+survey-yes:
+  paths:
+    good: market.good | pilot.positive, survey.yes
+    bad: market.bad | pilot.positive, survey.yes
+good:
+bad:
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	probs := make(map[string]float64)
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		for _, hedge := range node.Hyperedges {
+			probs[node.Name+"->"+hedge.Path] = hedge.Prob
+			for _, child := range hedge.Children {
+				walk(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	want := map[string]float64{
+		"pilot->after-positive": .5,
+		"pilot->after-negative": .5,
+		"after-positive->good":  .64,
+		"after-positive->bad":   .36,
+		"after-negative->good":  .16,
+		"after-negative->bad":   .84,
+		"survey->survey-yes":    .648,
+		"survey->bad":           .352,
+		"survey-yes->good":      .288 / .324,
+		"survey-yes->bad":       .036 / .324,
+	}
+	for k, w := range want {
+		Tassert(t, math.Abs(probs[k]-w) < 1e-9, "%s: got %v want %v", k, probs[k], w)
+	}
+	hedge := roots[0].Hyperedges[1]
+	Tassert(t, roots[0].Name == "pilot", "root %s", roots[0].Name)
+	Tassert(t, hedge.Outcomes["pilot"] == "positive", "outcomes %v", hedge.Outcomes)
+}
+
+func TestBayesErrors(t *testing.T) {
+	prior := "uncertainties:\n  m: {good: .5, bad: .5}\n"
+	cases := map[string]string{
+		"tests:\n  t:\n    of: m\n    signals:\n      yes: {good: .9, bad: .2}\n      no: {good: .2, bad: .8}\n":       "add up to",
+		"tests:\n  t:\n    of: m\n    signals:\n      yes: {good: 1}\n":                                                "missing likelihood for bad",
+		"tests:\n  t:\n    of: nope\n    signals:\n      yes: {good: 1}\n":                                             "no such uncertainty",
+		"tests:\n  t:\n    of: m\n    signals:\n      yes: {good: 1, bad: 1}\na:\n  paths:\n    b: m.good | t.maybe\n": "t has no signal maybe",
+	}
+	for yml, want := range cases {
+		_, err := FromYAML([]byte(prior + yml))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: want %q, got %v", yml, want, err)
+	}
+}
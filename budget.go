@@ -0,0 +1,86 @@
+package tree
+
+import (
+	"fmt"
+	"time"
+)
+
+// A model-level budget gives the cash on hand at the start and the
+// credit line that can be drawn on:
+//
+//	budget:
+//	  cash: 2M
+//	  credit: 500k
+//
+// Forward then keeps a running balance along each path, adding each
+// cash flow event as it happens, undiscounted.  A path whose balance
+// drops below the credit line has run out of money: it is reported
+// with warn, highlighted in the graph, and counted in the risk
+// metrics.  Each path is funded on its own; the children of a joint
+// path don't share a balance.
+
+// Budget is the model-level funding.
+type Budget struct {
+	Cash   string
+	Credit string `yaml:",omitempty"`
+}
+
+// budget is the evaluated Budget.
+type budget struct {
+	cash   float64
+	credit float64
+}
+
+// resolveBudget evaluates the budget.
+func (m *Model) resolveBudget() (err error) {
+	m.budget = nil
+	if m.Budget == nil {
+		return
+	}
+	b := &budget{}
+	b.cash, err = evalAmount(m.Budget.Cash, m.vars)
+	if err != nil {
+		return fmt.Errorf("budget: cash: %v", err)
+	}
+	b.credit, err = evalAmount(m.Budget.Credit, m.vars)
+	if err != nil {
+		return fmt.Errorf("budget: credit: %v", err)
+	}
+	if b.credit < 0 {
+		return fmt.Errorf("budget: credit can't be negative: %v", b.credit)
+	}
+	m.budget = b
+	return
+}
+
+// budgeted reports whether the node's model has a budget.
+func (a *Ast) budgeted() bool {
+	return a.model != nil && a.model.budget != nil
+}
+
+// startBalance sets the path balance of a root to the budget's cash.
+func (a *Ast) startBalance() {
+	if !a.budgeted() {
+		return
+	}
+	a.Path.Balance = a.model.budget.cash
+	a.Path.MinBalance = a.Path.Balance
+}
+
+// spend adds a cash flow event to the path balance, and marks the node
+// broke if the balance drops below the credit line for the first time
+// on the path.
+func (a *Ast) spend(date time.Time, cash float64, warn Warn) {
+	a.Path.Balance += cash
+	if a.Path.Balance >= a.Path.MinBalance {
+		return
+	}
+	a.Path.MinBalance = a.Path.Balance
+	if !a.budgeted() || a.Broke || a.Path.Balance >= -a.model.budget.credit {
+		return
+	}
+	a.Broke = true
+	a.brokeHere = true
+	warn("broke: %s balance %s on %s, credit line %s\n", a.Name, form(a.Path.Balance),
+		date.Format("2006-01-02"), form(a.model.budget.credit))
+}
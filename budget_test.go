@@ -0,0 +1,90 @@
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestBudget(t *testing.T) {
+	src := `
+budget:
+  cash: 1M
+  credit: limit
+params:
+  limit: 500k
+build:
+  cash: -1.2M
+  days: 30
+  paths:
+    overrun: .25
+    launch: .75
+overrun:
+  cash: -200k
+  days: 30
+  repeat: 2
+  paths:
+    launch: 1
+launch:
+  cash: 300k
+  days: 90
+  repeat: 4
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var warnings []string
+	warn := func(args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(args[0].(string), args[1:]...))
+	}
+	Recalc(roots, now, warn)
+	build := roots[0]
+	launch := build.Hyperedges[0].Children[0]
+	overrun := build.Hyperedges[1].Children[0]
+	Tassert(t, launch.Name == "launch" && overrun.Name == "overrun", "got %s %s", launch.Name, overrun.Name)
+
+	// building draws 200k of credit
+	Tassert(t, build.Path.Balance == -200000 && build.Path.MinBalance == -200000, "build balance %v", build.Path)
+	Tassert(t, !build.Broke, "build is broke")
+	Tassert(t, launch.Path.MinBalance == -200000 && launch.Path.Balance == 1000000, "launch balance %v", launch.Path)
+
+	// the overrun's second period goes past the credit line
+	Tassert(t, overrun.Broke && overrun.Path.MinBalance == -600000, "overrun balance %v", overrun.Path)
+	after := overrun.Hyperedges[0].Children[0]
+	Tassert(t, after.Broke && after.Path.MinBalance == -600000, "launch after overrun %v", after.Path)
+	got := strings.Join(warnings, "")
+	Tassert(t, strings.Contains(got, "broke: overrun balance -600,000 on 2023-04-01, credit line 500,000"), "got %q", got)
+	Tassert(t, strings.Count(got, "broke:") == 1, "got %q", got)
+
+	Tassert(t, build.Risk.PBroke == .25, "p(broke) %v", build.Risk.PBroke)
+	want := .75*-200000 + .25*-600000
+	Tassert(t, build.Expected.MinBalance == want, "expected min balance %v want %v", build.Expected.MinBalance, want)
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, "min balance"), "missing balance in dot")
+	Tassert(t, strings.Contains(dot, "penwidth=3"), "missing broke highlight in dot")
+
+	buf, err := ToJSON(roots)
+	Tassert(t, err == nil, "%v", err)
+	var nodes []map[string]interface{}
+	err = json.Unmarshal(buf, &nodes)
+	Tassert(t, err == nil, "%v", err)
+	path := nodes[0]["path"].(map[string]interface{})
+	Tassert(t, path["minBalance"] == -200000.0, "json min balance %v", path["minBalance"])
+}
+
+func TestBudgetErrors(t *testing.T) {
+	cases := map[string]string{
+		"budget: {cash: x}\na: {days: 1}":              "budget: cash",
+		"budget: {cash: 1M, credit: -5}\na: {days: 1}": "credit can't be negative",
+		"budget: {cash: 1M, credit: 1/}\na: {days: 1}": "budget: credit",
+	}
+	for src, want := range cases {
+		_, err := FromYAML([]byte(src))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: got %v, want %q", src, err, want)
+	}
+}
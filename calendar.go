@@ -0,0 +1,158 @@
+package tree
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// CalendarSpec is the model-level `calendar:` section, e.g.:
+//
+//	calendar:
+//	  weekends: [sat, sun]
+//	  holidays: [2023-12-25, 2024-01-01]
+//	  holidayFile: holidays.txt
+//
+// The holiday file has one date (2006-01-02) per line; blank lines
+// and anything after a '#' are ignored.  Its path is relative to the
+// model file that has the `calendar:` section.
+type CalendarSpec struct {
+	Weekends    []string `yaml:",omitempty"`
+	Holidays    []string `yaml:",omitempty"`
+	HolidayFile string   `yaml:"holidayFile,omitempty"`
+
+	dir  string   // of the model file, if any
+	read ReadFunc // nil reads from the file system
+}
+
+// Calendar says which days are working days.  Nodes with `workdays:`
+// are scheduled on it.
+type Calendar struct {
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// NewCalendar returns a calendar with Saturday and Sunday weekends
+// and no holidays.
+func NewCalendar() (cal *Calendar) {
+	cal = &Calendar{
+		weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: make(map[string]bool),
+	}
+	return
+}
+
+// Load builds a Calendar from the spec.  A nil spec returns the
+// default calendar.
+func (spec *CalendarSpec) Load() (cal *Calendar, err error) {
+	cal = NewCalendar()
+	if spec == nil {
+		return
+	}
+	if spec.Weekends != nil {
+		cal.weekend = make(map[time.Weekday]bool)
+		for _, name := range spec.Weekends {
+			key := strings.ToLower(strings.TrimSpace(name))
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			day, ok := weekdayNames[key]
+			if !ok {
+				err = fmt.Errorf("calendar: invalid weekday: %q", name)
+				return
+			}
+			cal.weekend[day] = true
+		}
+	}
+	holidays := spec.Holidays
+	if spec.HolidayFile != "" {
+		fn := spec.HolidayFile
+		if !path.IsAbs(fn) {
+			if spec.dir == "" {
+				err = fmt.Errorf("calendar: relative holidayFile %s needs a model file to be relative to", fn)
+				return
+			}
+			fn = path.Join(spec.dir, fn)
+		}
+		read := spec.read
+		if read == nil {
+			read = ioutil.ReadFile
+		}
+		var buf []byte
+		buf, err = read(fn)
+		if err != nil {
+			err = fmt.Errorf("calendar: %v", err)
+			return
+		}
+		holidays = append(holidays, parseHolidays(buf)...)
+	}
+	for _, h := range holidays {
+		var t time.Time
+		t, err = time.Parse("2006-01-02", h)
+		if err != nil {
+			err = fmt.Errorf("calendar: invalid holiday: %v", err)
+			return
+		}
+		cal.holidays[t.Format("2006-01-02")] = true
+	}
+	return
+}
+
+// parseHolidays returns the dates listed in a holiday file.
+func parseHolidays(buf []byte) (dates []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		dates = append(dates, line)
+	}
+	return
+}
+
+// IsWorkday returns true if t falls on a working day.
+func (cal *Calendar) IsWorkday(t time.Time) bool {
+	if cal.weekend[t.Weekday()] {
+		return false
+	}
+	return !cal.holidays[t.Format("2006-01-02")]
+}
+
+// NextWorkday returns t if it falls on a working day, otherwise the
+// same time of day on the next working day.
+func (cal *Calendar) NextWorkday(t time.Time) time.Time {
+	for i := 0; i < 366 && !cal.IsWorkday(t); i++ {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// AddWorkdays returns the time n working days after t, skipping
+// weekends and holidays.
+func (cal *Calendar) AddWorkdays(t time.Time, n int) time.Time {
+	for n > 0 {
+		t = cal.NextWorkday(t)
+		t = t.AddDate(0, 0, 1)
+		n--
+	}
+	return t
+}
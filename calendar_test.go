@@ -0,0 +1,112 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestCalendar(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "holidays.txt")
+	err := os.WriteFile(fn, []byte("# company holidays\n2023-01-06  # epiphany\n\n"), 0644)
+	Tassert(t, err == nil, "%v", err)
+
+	spec := &CalendarSpec{
+		Weekends:    []string{"Saturday", "sun"},
+		Holidays:    []string{"2023-01-09"},
+		HolidayFile: fn,
+	}
+	cal, err := spec.Load()
+	Tassert(t, err == nil, "%v", err)
+
+	// Wed Jan 4 2023
+	wed := time.Date(2023, time.January, 4, 9, 0, 0, 0, time.UTC)
+	Tassert(t, cal.IsWorkday(wed), "wed should be a workday")
+	Tassert(t, !cal.IsWorkday(wed.AddDate(0, 0, 2)), "holiday from file")
+	Tassert(t, !cal.IsWorkday(wed.AddDate(0, 0, 5)), "holiday from list")
+
+	// wed, thu, then fri is a holiday, sat/sun weekend, mon holiday,
+	// so 3 workdays end after tue
+	got := cal.AddWorkdays(wed, 3)
+	want := time.Date(2023, time.January, 11, 9, 0, 0, 0, time.UTC)
+	Tassert(t, got.Equal(want), "got %v want %v", got, want)
+
+	_, err = (&CalendarSpec{Weekends: []string{"caturday"}}).Load()
+	Tassert(t, err != nil, "expected error for invalid weekday")
+}
+
+func TestWorkdays(t *testing.T) {
+	buf := []byte(`
+calendar:
+  holidays: [2023-01-16]
+design:
+  workdays: 6
+  paths:
+    build: 1
+build:
+  workdays: 2
+  repeat: 2
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	// Fri Jan 6 2023
+	now := time.Date(2023, time.January, 6, 9, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	design := roots[0]
+	build := design.Hyperedges[0].Children[0]
+	// fri, mon, tue, wed, thu, fri
+	Tassert(t, design.End.Equal(time.Date(2023, time.January, 14, 9, 0, 0, 0, time.UTC)), "design end %v", design.End)
+	// would start on sat, idles past the weekend and the monday
+	// holiday, then tue-wed, thu-fri
+	Tassert(t, build.Start.Equal(time.Date(2023, time.January, 17, 9, 0, 0, 0, time.UTC)), "build start %v", build.Start)
+	Tassert(t, build.Idle == 3*24*time.Hour, "build idle %v", build.Idle)
+	Tassert(t, build.End.Equal(time.Date(2023, time.January, 21, 9, 0, 0, 0, time.UTC)), "build end %v", build.End)
+
+	_, err = FromYAML([]byte("calendar:\n  weekends: [xyz]\nfoo:\n  days: 1\n"))
+	Tassert(t, err != nil, "expected calendar error")
+}
+
+func TestHolidayFile(t *testing.T) {
+	// relative to the model file, not the working directory
+	dir := writeFiles(t, map[string]string{
+		"plan.yaml": `
+calendar:
+  holidayFile: holidays.txt
+build:
+  workdays: 1
+`,
+		"holidays.txt": "2023-01-05\n",
+	})
+	roots, err := FromFile(filepath.Join(dir, "plan.yaml"))
+	Tassert(t, err == nil, "%v", err)
+	// Thu Jan 5 2023 is a holiday, so the work is done on Fri
+	now := time.Date(2023, time.January, 5, 9, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	want := time.Date(2023, time.January, 7, 9, 0, 0, 0, time.UTC)
+	Tassert(t, roots[0].End.Equal(want), "got %v want %v", roots[0].End, want)
+
+	// and to the included file that has the calendar, through the
+	// same ReadFunc
+	files := map[string]string{
+		"models/plan.yaml":        "include: [cal/work.yaml]\nbuild:\n  workdays: 1\n",
+		"models/cal/work.yaml":    "calendar:\n  holidayFile: holidays.txt\n",
+		"models/cal/holidays.txt": "2023-01-05\n",
+	}
+	read := func(fn string) ([]byte, error) {
+		body, ok := files[fn]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(body), nil
+	}
+	model, err := LoadModel("models/plan.yaml", read)
+	Tassert(t, err == nil, "%v", err)
+	roots = model.ToAst()
+	Recalc(roots, now, testWarn(t))
+	Tassert(t, roots[0].End.Equal(want), "got %v want %v", roots[0].End, want)
+}
@@ -14,10 +14,38 @@ import (
 	tree "github.com/stevegt/godecide"
 )
 
-var usage string = `Usage: %s [-tb -now=<RFC3339 timestamp>] {src} {dst}
+var usage string = `Usage: %s [-tb -risk -avgmirr -leveling -level=<0..1> -now=<RFC3339 timestamp>] {src} {dst}
+       %s criteria [-alpha=<0..1> -now=<RFC3339 timestamp>] {src}
+       %s profile [-now=<RFC3339 timestamp>] {src} [{dst.svg}]
+       %s resources [-leveling -now=<RFC3339 timestamp>] {src}
+       %s portfolio [-budget=<amount> -resources -now=<RFC3339 timestamp>] {src}
+       %s forecast [-period=month|quarter|year -now=<RFC3339 timestamp>] {src} [{dst.csv|dst.svg}]
 
 src: either 'stdin', 'example:NAME', or a filename
-dst: either (stdout|xdot|yaml) or a filename
+dst: either (stdout|xdot|yaml|json) or a filename
+
+The criteria subcommand ranks the alternatives of each decision
+without using the probabilities: maximin, maximax, Hurwicz and
+minimax regret, plus a regret table.
+
+The profile subcommand lists the distribution of leaf outcomes of
+each root and each decision alternative, reports first and second
+order stochastic dominance between alternatives, and optionally
+draws the cumulative risk profiles as SVG.
+
+The resources subcommand reports where nodes that can run at the
+same time need more of a resource than the model's capacity.  With
+-leveling, nodes are delayed to fit first, here and in the main
+command.
+
+The portfolio subcommand treats each root as a candidate project and
+picks the set with the largest total expected NPV that fits the
+budget (the model's cash plus credit line, or -budget), and with
+-resources the model's capacity, and prints the efficient frontier.
+
+The forecast subcommand buckets the cash flows of each root by
+calendar period, with the expected cash and the P10 and P90 across
+leaves, as CSV on stdout or in a file, or as an SVG chart.
 
 %s
 
@@ -32,15 +60,41 @@ func main() {
 
 	// set custom usage
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0], tree.LsExamples(fs))
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], tree.LsExamples(fs))
 		fmt.Fprint(os.Stderr, "Flags:\n\n")
 		flag.PrintDefaults()
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "criteria" {
+		criteria(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "profile" {
+		profile(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "resources" {
+		resources(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "portfolio" {
+		portfolio(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "forecast" {
+		forecast(os.Args[2:])
+		return
+	}
+
 	// parse flags
 	var tb bool
+	var opts tree.Options
 	nowStr := time.Now().Format(time.RFC3339)
 	flag.BoolVar(&tb, "tb", false, "set graphviz rankdir=TB (top to bottom)")
+	flag.BoolVar(&opts.ShowRisk, "risk", false, "show risk metrics in the graph")
+	flag.BoolVar(&opts.Leveling, "leveling", false, "delay nodes to fit the resource capacity")
+	flag.BoolVar(&opts.AverageMirr, "avgmirr", false, "average the children's MIRRs instead of taking the MIRR of the expected cash flows")
+	flag.Float64Var(&opts.RiskLevel, "level", tree.DefaultRiskLevel, "confidence level for VaR and CVaR")
 	flag.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
 	flag.Parse()
 
@@ -51,39 +105,27 @@ func main() {
 
 	now, err := time.Parse(time.RFC3339, nowStr)
 	Ck(err)
+	Assert(opts.RiskLevel > 0 && opts.RiskLevel <= 1, "-level must be between 0 and 1")
 
 	// get src and dst
 	src := flag.Arg(0)
 	dst := flag.Arg(1)
 
-	var buf []byte
-
-	// get input
-	switch {
-	case strings.HasPrefix(src, "example:"):
-		buf, err = tree.CatExample(fs, src)
-		Ck(err)
-	case src == "stdin":
-		buf, err = ioutil.ReadAll(os.Stdin)
-		Ck(err)
-	default:
-		buf, err = ioutil.ReadFile(src)
-		Ck(err)
-	}
-
-	// parse
-	roots, err := tree.FromYAML(buf)
-	Ck(err)
+	buf, roots := load(src)
 
-	tree.Recalc(roots, now, warn)
+	tree.RecalcWith(roots, now, warn, opts)
 
-	dotbuf := tree.ToDot(roots, warn, tb)
+	dotbuf := tree.ToDotWith(roots, warn, tb, opts)
 
 	switch dst {
 	case "stdout":
 		fmt.Print(string(dotbuf))
 	case "yaml":
 		fmt.Print(string(buf))
+	case "json":
+		jsonbuf, err := tree.ToJSON(roots)
+		Ck(err)
+		fmt.Println(string(jsonbuf))
 	case "xdot":
 		tmpfile, err := ioutil.TempFile("/tmp", "godecide.*.dot")
 		Ck(err)
@@ -133,3 +175,174 @@ func formatArgs(args ...interface{}) (msg string) {
 	}
 	return
 }
+
+// load reads and parses src; included files are read relative to it.
+func load(src string) (buf []byte, roots []*tree.Ast) {
+	var err error
+	fs := tree.ExamplesFS
+	switch {
+	case strings.HasPrefix(src, "example:"):
+		buf, err = tree.CatExample(fs, src)
+		Ck(err)
+		fn := fmt.Sprintf("examples/%s.yaml", strings.TrimPrefix(src, "example:"))
+		model, err := tree.LoadModel(fn, fs.ReadFile)
+		Ck(err)
+		roots = model.ToAst()
+	case src == "stdin":
+		buf, err = ioutil.ReadAll(os.Stdin)
+		Ck(err)
+		roots, err = tree.FromYAML(buf)
+		Ck(err)
+	default:
+		buf, err = ioutil.ReadFile(src)
+		Ck(err)
+		roots, err = tree.FromFile(src)
+		Ck(err)
+	}
+	return
+}
+
+// criteria runs the criteria subcommand.
+func criteria(args []string) {
+	flags := flag.NewFlagSet("criteria", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	nowStr := time.Now().Format(time.RFC3339)
+	alpha := flags.Float64("alpha", 0.5, "Hurwicz weight of the best outcome (0..1)")
+	flags.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	Ck(err)
+
+	_, roots := load(flags.Arg(0))
+	tree.Recalc(roots, now, warn)
+	analyses, err := tree.AnalyzeScenarios(roots, *alpha)
+	Ck(err)
+	for i, sa := range analyses {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(sa)
+	}
+}
+
+// profile runs the profile subcommand.
+func profile(args []string) {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	nowStr := time.Now().Format(time.RFC3339)
+	flags.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	Ck(err)
+
+	_, roots := load(flags.Arg(0))
+	tree.Recalc(roots, now, warn)
+	profiles := tree.Profiles(roots)
+	fmt.Print(tree.ProfileText(profiles))
+	if flags.NArg() == 2 {
+		err = ioutil.WriteFile(flags.Arg(1), tree.ProfileSVG(profiles), 0644)
+		Ck(err)
+	}
+}
+
+// forecast runs the forecast subcommand.
+func forecast(args []string) {
+	flags := flag.NewFlagSet("forecast", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	nowStr := time.Now().Format(time.RFC3339)
+	period := flags.String("period", "quarter", "forecast period: month, quarter or year")
+	flags.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	Ck(err)
+
+	_, roots := load(flags.Arg(0))
+	tree.Recalc(roots, now, warn)
+	forecasts, err := tree.Forecasts(roots, *period)
+	Ck(err)
+	switch {
+	case flags.NArg() == 1:
+		fmt.Print(string(tree.ForecastCSV(forecasts)))
+	case path.Ext(flags.Arg(1)) == ".svg":
+		err = ioutil.WriteFile(flags.Arg(1), tree.ForecastSVG(forecasts), 0644)
+		Ck(err)
+	default:
+		err = ioutil.WriteFile(flags.Arg(1), tree.ForecastCSV(forecasts), 0644)
+		Ck(err)
+	}
+}
+
+// resources runs the resources subcommand.
+func resources(args []string) {
+	flags := flag.NewFlagSet("resources", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	var opts tree.Options
+	nowStr := time.Now().Format(time.RFC3339)
+	flags.BoolVar(&opts.Leveling, "leveling", false, "delay nodes to fit the resource capacity")
+	flags.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	Ck(err)
+
+	_, roots := load(flags.Arg(0))
+	tree.RecalcWith(roots, now, func(args ...interface{}) {}, opts)
+	for _, root := range roots {
+		root.Walk(func(node *tree.Ast) {
+			if node.LevelStart.Equal(node.Start) && !node.LevelStart.IsZero() {
+				fmt.Printf("delayed: %s starts %s\n", node.Name, node.Start.Format("2006-01-02"))
+			}
+		})
+	}
+	over := tree.Overallocations(roots)
+	if len(over) == 0 {
+		fmt.Println("no overallocation")
+	}
+	for _, o := range over {
+		fmt.Printf("overallocated: %s\n", o)
+	}
+}
+
+// portfolio runs the portfolio subcommand.
+func portfolio(args []string) {
+	flags := flag.NewFlagSet("portfolio", flag.ExitOnError)
+	flags.Usage = flag.Usage
+	nowStr := time.Now().Format(time.RFC3339)
+	budgetStr := flags.String("budget", "", "budget to fit, e.g. 3M (default: the model's cash plus credit line)")
+	useResources := flags.Bool("resources", false, "also fit the peak resource use to the model's capacity")
+	flags.StringVar(&nowStr, "now", nowStr, "set timestamp (in RFC3339 format) for current time")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	Ck(err)
+	var budget *float64
+	if *budgetStr != "" {
+		amount, err := tree.ParseAmount(*budgetStr)
+		Ck(err)
+		budget = &amount
+	}
+
+	_, roots := load(flags.Arg(0))
+	tree.Recalc(roots, now, warn)
+	pa, err := tree.SelectPortfolio(roots, budget, *useResources)
+	Ck(err)
+	fmt.Print(pa)
+}
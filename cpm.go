@@ -0,0 +1,255 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// The critical path is found with the critical path method (CPM),
+// adapted to trees.  The children of one path run in parallel and
+// must all finish before the path is done, while the paths out of a
+// node are alternatives, only one of which happens.  The forward pass
+// is Forward: each node's early start and finish are its Start and
+// End.  Each subtree then gets an expected finish, weighting the
+// alternatives under it by probability, and the backward pass here
+// hands each node its total float: its parent's float plus how much
+// earlier its subtree finishes than the latest sibling in the same
+// path.  Alternatives don't wait for each other, so they don't give
+// each other float.  Nodes with zero float are critical.
+//
+// A node's `prereqs` list alternative joins, each a comma-separated
+// list of nodes that must all have ended before it can start, e.g.
+// `backend,frontend` or `prototype`.  The node starts when the joins
+// are expected to have ended, weighting each join by the probability
+// of reaching it, and the nodes in a join get float from how much
+// earlier they end than the join does.
+
+// criticalEps is how close to zero a float has to be to count as
+// critical, to absorb rounding in fractional days.
+const criticalEps = time.Second
+
+// prereqJoins splits the node's prereqs into joins of node names.
+func prereqJoins(prereqs []string) (joins [][]string) {
+	for _, p := range prereqs {
+		var join []string
+		for _, name := range strings.Split(p, ",") {
+			join = append(join, strings.TrimSpace(name))
+		}
+		joins = append(joins, join)
+	}
+	return
+}
+
+// prereqStart returns when the node's prereq joins are expected to
+// have ended, or the zero time if it has none or they haven't been
+// reached.
+func (a *Ast) prereqStart() (start time.Time) {
+	if a.model == nil || len(a.src.Prereqs) == 0 {
+		return
+	}
+	var sum, total float64
+	for _, join := range prereqJoins(a.src.Prereqs) {
+		end, reach := a.model.joinEnd(join)
+		if reach <= 0 {
+			continue
+		}
+		sum += reach * float64(end.UnixNano())
+		total += reach
+	}
+	if total == 0 {
+		return
+	}
+	return time.Unix(0, int64(sum/total)).In(a.Start.Location())
+}
+
+// joinEnd returns the end of the last node of a join and the
+// probability of reaching all of it.  A node reached along several
+// paths ends at the probability-weighted average of their ends.
+func (m *Model) joinEnd(join []string) (end time.Time, reach float64) {
+	reach = 1
+	for _, name := range join {
+		var sum, total float64
+		for _, node := range m.ends[name] {
+			sum += node.Reach * float64(node.End.UnixNano())
+			total += node.Reach
+		}
+		if total == 0 {
+			return time.Time{}, 0
+		}
+		reach = math.Min(reach, total)
+		nodeEnd := time.Unix(0, int64(sum/total))
+		if nodeEnd.After(end) {
+			end = nodeEnd
+		}
+	}
+	return
+}
+
+// prereqOrder returns the roots ordered so that every prereq is in a
+// tree before the trees that wait for it.  Roots in a cycle keep their
+// order, and their prereqs are ignored if not yet reached.
+func prereqOrder(roots []*Ast, warn Warn) (ordered []*Ast) {
+	has := make([]map[string]bool, len(roots))
+	needs := make([]map[string]bool, len(roots))
+	for i, root := range roots {
+		has[i] = make(map[string]bool)
+		needs[i] = make(map[string]bool)
+		root.Walk(func(node *Ast) {
+			has[i][node.Name] = true
+			for _, join := range prereqJoins(node.src.Prereqs) {
+				for _, name := range join {
+					needs[i][name] = true
+				}
+			}
+		})
+	}
+	done := make([]bool, len(roots))
+	for len(ordered) < len(roots) {
+		progress := false
+		for i, root := range roots {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for name := range needs[i] {
+				for j := range roots {
+					if j != i && !done[j] && has[j][name] {
+						ready = false
+					}
+				}
+			}
+			if ready {
+				ordered = append(ordered, root)
+				done[i] = true
+				progress = true
+			}
+		}
+		if !progress {
+			for i, root := range roots {
+				if !done[i] {
+					warn("prereqs: cycle through %s\n", root.Name)
+					ordered = append(ordered, root)
+					done[i] = true
+				}
+			}
+		}
+	}
+	return
+}
+
+// Walk calls f on the node and every node under it.
+func (a *Ast) Walk(f func(node *Ast)) {
+	f(a)
+	for _, hedge := range a.Hyperedges {
+		for _, child := range hedge.Children {
+			child.Walk(f)
+		}
+	}
+}
+
+// finish returns the expected end of the node's subtree, weighting
+// alternative paths by probability.  A path ends when its last child
+// subtree does.
+func (a *Ast) finish() time.Time {
+	if len(a.Hyperedges) == 0 {
+		return a.End
+	}
+	var sum, total float64
+	for _, hedge := range a.Hyperedges {
+		var last time.Time
+		for _, child := range hedge.Children {
+			if end := child.finish(); end.After(last) {
+				last = end
+			}
+		}
+		sum += hedge.Prob * float64(last.UnixNano())
+		total += hedge.Prob
+	}
+	if total == 0 {
+		return a.End
+	}
+	return time.Unix(0, int64(sum/total)).In(a.End.Location())
+}
+
+// setFloat hands float down the tree: each child gets its parent's
+// float plus the time its subtree finishes before the latest one in
+// the same path.
+func (a *Ast) setFloat(float time.Duration) {
+	a.Float = float
+	for _, hedge := range a.Hyperedges {
+		var last time.Time
+		finishes := make([]time.Time, len(hedge.Children))
+		for i, child := range hedge.Children {
+			finishes[i] = child.finish()
+			if finishes[i].After(last) {
+				last = finishes[i]
+			}
+		}
+		for i, child := range hedge.Children {
+			child.setFloat(float + last.Sub(finishes[i]))
+		}
+	}
+}
+
+// limitFloat lowers the float of the nodes in each of the node's
+// prereq joins to how much later the join ends than they do, plus the
+// node's own float, and lowers their ancestors' float to match.
+func (a *Ast) limitFloat() {
+	if a.model == nil {
+		return
+	}
+	for _, join := range prereqJoins(a.src.Prereqs) {
+		end, reach := a.model.joinEnd(join)
+		if reach <= 0 {
+			continue
+		}
+		for _, name := range join {
+			for _, node := range a.model.ends[name] {
+				slack := a.Float + end.Sub(node.End)
+				if slack < node.Float {
+					node.Float = slack
+				}
+			}
+		}
+	}
+}
+
+// SetCriticalPath computes the total float of every node in the tree,
+// after Forward and Backward, and marks the nodes with zero float as
+// critical.  Recalc does this for all the roots at once, so that
+// prereqs in other trees are taken into account.
+func (this *Ast) SetCriticalPath() {
+	criticalPath([]*Ast{this})
+}
+
+// criticalPath sets the float of every node in the trees.  Late start
+// and finish are the early ones plus the float.
+func criticalPath(roots []*Ast) {
+	for _, root := range roots {
+		root.setFloat(0)
+	}
+	for _, root := range roots {
+		root.Walk(func(node *Ast) { node.limitFloat() })
+	}
+	// a node can't have more float than any node after it
+	var lower func(node *Ast) time.Duration
+	lower = func(node *Ast) time.Duration {
+		for _, hedge := range node.Hyperedges {
+			for _, child := range hedge.Children {
+				if f := lower(child); f < node.Float {
+					node.Float = f
+				}
+			}
+		}
+		return node.Float
+	}
+	for _, root := range roots {
+		lower(root)
+		root.Walk(func(node *Ast) {
+			node.LateStart = node.Start.Add(node.Float)
+			node.LateFinish = node.End.Add(node.Float)
+			node.Critical = node.Float < criticalEps
+		})
+	}
+}
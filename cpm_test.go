@@ -0,0 +1,105 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestCriticalPath(t *testing.T) {
+	data, err := testFS.ReadFile("examples/pert.yaml")
+	Tassert(t, err == nil, "%v", err)
+	roots, err := FromYAML(data)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	nodes := make(map[string]*Ast)
+	for _, root := range roots {
+		root.Walk(func(node *Ast) { nodes[node.Name] = node })
+	}
+	day := 24 * time.Hour
+
+	// testing waits for either backend and frontend, ending on day 24,
+	// or the prototype, ending on day 30
+	testing := nodes["testing"]
+	Tassert(t, testing.Start.Equal(now.Add(27*day)), "testing start %v", testing.Start)
+	Tassert(t, testing.Idle == 27*day, "testing idle %v", testing.Idle)
+	Tassert(t, nodes["deployment"].Start.Equal(now.Add(32*day)), "deployment start %v", nodes["deployment"].Start)
+
+	// frontend ends two days before backend
+	frontend := nodes["frontend"]
+	Tassert(t, frontend.Float == 2*day, "frontend float %v", frontend.Float)
+	Tassert(t, !frontend.Critical, "frontend is critical")
+	Tassert(t, frontend.LateFinish.Equal(frontend.End.Add(2*day)), "frontend late finish %v", frontend.LateFinish)
+	Tassert(t, frontend.LateStart.Equal(frontend.Start.Add(2*day)), "frontend late start %v", frontend.LateStart)
+	for _, name := range []string{"requirements", "code_alt", "backend", "prototype", "testing"} {
+		Tassert(t, nodes[name].Critical, "%s not critical, float %v", name, nodes[name].Float)
+	}
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, "float: 2 days"), "missing float in dot")
+}
+
+func TestCriticalPathAlternatives(t *testing.T) {
+	src := `
+start:
+  days: 1
+  paths:
+    short: .5
+    long: .5
+short:
+  days: 10
+  paths:
+    end: 1
+long:
+  days: 30
+end:
+  days: 5
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	long := roots[0].Hyperedges[0].Children[0]
+	short := roots[0].Hyperedges[1].Children[0]
+	Tassert(t, long.Name == "long" && short.Name == "short", "got %s %s", long.Name, short.Name)
+	// only one of the alternatives happens, so neither waits for the
+	// other
+	end := short.Hyperedges[0].Children[0]
+	for _, node := range []*Ast{long, short, end} {
+		Tassert(t, node.Float == 0 && node.Critical, "%s float %v", node.Name, node.Float)
+	}
+}
+
+func TestPrereqCycle(t *testing.T) {
+	src := `
+a:
+  days: 1
+  prereqs: [d]
+  paths:
+    b: 1
+b:
+  days: 1
+c:
+  days: 1
+  prereqs: [b]
+  paths:
+    d: 1
+d:
+  days: 1
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	var warnings []string
+	warn := func(args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(args[0].(string), args[1:]...))
+	}
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, warn)
+	got := strings.Join(warnings, "")
+	Tassert(t, strings.Contains(got, "prereqs: cycle through a"), "got %q", got)
+}
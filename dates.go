@@ -0,0 +1,141 @@
+package tree
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/date/period"
+)
+
+// DateBase says what a DateRef is measured from.
+type DateBase int
+
+const (
+	// DateAbs is a calendar date, e.g. 2022-04-15.
+	DateAbs DateBase = iota
+	// DateNow is relative to the evaluation time (the -now flag).
+	DateNow
+	// DateStart is relative to the start of the root node.
+	DateStart
+)
+
+// DateRef is a parsed `due` or `notBefore` field.  It is either an
+// absolute date or an offset from the evaluation time or from the
+// root start, e.g.:
+//
+//	due: 2022-04-15
+//	due: +90d          # 90 days after -now
+//	due: now+3m        # 3 months after -now
+//	due: start+30d     # 30 days after the root node starts
+//	notBefore: start+P1Y2M
+type DateRef struct {
+	Base   DateBase
+	Date   time.Time
+	Offset period.Period
+	src    string
+}
+
+var dateRefRe = regexp.MustCompile(`^(now|start)?\s*(?:([+-])\s*(.+))?$`)
+
+// offsetUnitRe matches an offset like `90d`, `2w`, `3 months` or `1y`.
+var offsetUnitRe = regexp.MustCompile(`^([0-9]+)\s*([A-Za-z]+)$`)
+
+// ParseDateRef parses a date field.  An empty string returns a zero
+// DateRef.
+func ParseDateRef(s string) (d DateRef, err error) {
+	s = strings.TrimSpace(s)
+	d.src = s
+	if s == "" {
+		return
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		t, perr := time.Parse(layout, s)
+		if perr == nil {
+			d.Base = DateAbs
+			d.Date = t
+			return
+		}
+	}
+	m := dateRefRe.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[2] == "") {
+		err = fmt.Errorf("invalid date: %q", s)
+		return
+	}
+	d.Base = DateNow
+	if m[1] == "start" {
+		d.Base = DateStart
+	}
+	if m[2] == "" {
+		return
+	}
+	d.Offset, err = parseOffset(m[3])
+	if err != nil {
+		err = fmt.Errorf("invalid date: %q: %v", s, err)
+		return
+	}
+	if m[2] == "-" {
+		d.Offset = d.Offset.Negate()
+	}
+	return
+}
+
+// parseOffset parses either a number with a unit (see unitOf) or an
+// ISO-8601 period such as P1Y2M.
+func parseOffset(s string) (p period.Period, err error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToUpper(s), "P") {
+		return period.Parse(strings.ToUpper(s), false)
+	}
+	m := offsetUnitRe.FindStringSubmatch(s)
+	if m == nil {
+		err = fmt.Errorf("invalid offset: %q", s)
+		return
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return
+	}
+	unit, err := unitOf(m[2])
+	if err != nil {
+		return
+	}
+	switch unit {
+	case 'd':
+		p = period.NewYMD(0, 0, n)
+	case 'w':
+		p = period.NewYMD(0, 0, n*7)
+	case 'm':
+		p = period.NewYMD(0, n, 0)
+	case 'y':
+		p = period.NewYMD(n, 0, 0)
+	}
+	return
+}
+
+// IsZero returns true if the field was not set.
+func (d DateRef) IsZero() bool {
+	return d.src == ""
+}
+
+// String returns the field as it was written in the YAML.
+func (d DateRef) String() string {
+	return d.src
+}
+
+// Resolve returns the date that d refers to, given the evaluation
+// time and the start of the root node.
+func (d DateRef) Resolve(now, start time.Time) (t time.Time) {
+	switch d.Base {
+	case DateAbs:
+		return d.Date
+	case DateNow:
+		t = now
+	case DateStart:
+		t = start
+	}
+	t, _ = d.Offset.AddTo(t)
+	return
+}
@@ -0,0 +1,71 @@
+package tree
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestParseDateRef(t *testing.T) {
+	now := time.Date(2023, time.January, 1, 9, 0, 0, 0, time.UTC)
+	start := time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		src  string
+		want time.Time
+	}{
+		{"2022-04-15", time.Date(2022, time.April, 15, 0, 0, 0, 0, time.UTC)},
+		{"2022-04-15T12:00:00Z", time.Date(2022, time.April, 15, 12, 0, 0, 0, time.UTC)},
+		{"+90d", now.AddDate(0, 0, 90)},
+		{"now + 2w", now.AddDate(0, 0, 14)},
+		{"now-1m", now.AddDate(0, -1, 0)},
+		{"now+3 months", now.AddDate(0, 3, 0)},
+		{"start+30d", start.AddDate(0, 0, 30)},
+		{"start+P1Y2M", start.AddDate(1, 2, 0)},
+		{"start", start},
+	}
+	for _, c := range cases {
+		d, err := ParseDateRef(c.src)
+		Tassert(t, err == nil, "%s: %v", c.src, err)
+		got := d.Resolve(now, start)
+		Tassert(t, got.Equal(c.want), "%s: got %v want %v", c.src, got, c.want)
+	}
+
+	d, err := ParseDateRef("")
+	Tassert(t, err == nil && d.IsZero(), "empty date should be zero")
+
+	for _, src := range []string{"soon", "+90", "start+3q"} {
+		_, err = ParseDateRef(src)
+		Tassert(t, err != nil, "%s: expected error", src)
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	buf := []byte(`
+sign:
+  days: 10
+  paths:
+    build: 1
+build:
+  days: 5
+  notBefore: start+30d
+  due: start+40d
+  paths:
+    ship: 1
+ship:
+  days: 2
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	sign := roots[0]
+	build := sign.Hyperedges[0].Children[0]
+	ship := build.Hyperedges[0].Children[0]
+	Tassert(t, build.Start.Equal(now.AddDate(0, 0, 30)), "build start %v", build.Start)
+	Tassert(t, build.Idle == 20*24*time.Hour, "build idle %v", build.Idle)
+	Tassert(t, build.Due.Equal(now.AddDate(0, 0, 40)), "build due %v", build.Due)
+	Tassert(t, ship.Start.Equal(now.AddDate(0, 0, 35)), "ship start %v", ship.Start)
+	Tassert(t, ship.Expected.Duration == 37*24*time.Hour, "ship duration %v", ship.Expected.Duration)
+}
@@ -0,0 +1,50 @@
+package tree
+
+import (
+	"math"
+
+	"github.com/stevegt/godecide/fin"
+)
+
+// expect sets the node's expected timeline to the merge of the leaf
+// timelines under it, each weighted by the probability of the
+// outcomes it's part of, and takes the expected NPV and MIRR from it.
+// The leaves of a joint path are all weighted in full, so parallel
+// work adds up, but the path up to the fork is only counted once.  A
+// node that missed its due date keeps a NaN MIRR.
+// With Options.AverageMirr, the NPV and MIRR are left as Backward
+// averaged them.
+func (a *Ast) expect() {
+	if len(a.Hyperedges) == 0 {
+		a.ExpectedTimeline = &a.Timeline
+		return
+	}
+	type part struct {
+		leaf *Ast
+		skip int
+	}
+	var tls []*fin.Timeline
+	var weights []float64
+	index := make(map[part]int)
+	for _, o := range a.dist {
+		for j, leaf := range o.Leaves {
+			key := part{leaf, o.skip[j]}
+			i, ok := index[key]
+			if !ok {
+				i = len(tls)
+				index[key] = i
+				tls = append(tls, leaf.Timeline.Tail(key.skip))
+				weights = append(weights, 0)
+			}
+			weights[i] += o.Prob
+		}
+	}
+	a.ExpectedTimeline = fin.Merge(tls, weights)
+	if a.opts.AverageMirr {
+		return
+	}
+	a.Expected.Npv = a.ExpectedTimeline.Npv()
+	if !math.IsNaN(a.Expected.Mirr) {
+		a.Expected.Mirr = a.ExpectedTimeline.Mirr()
+	}
+}
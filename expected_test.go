@@ -0,0 +1,113 @@
+package tree
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestExpectedTimeline(t *testing.T) {
+	src := `
+start:
+  cash: -100
+  days: 365
+  finrate: .1
+  rerate: .1
+  paths:
+    spend: .5
+    free: .5
+spend:
+  cash: 60
+  days: 365
+  repeat: 3
+free:
+  cash: 30
+  days: 365
+`
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, now, testWarn(t))
+	root := roots[0]
+	spend := root.Hyperedges[1].Children[0]
+	free := root.Hyperedges[0].Children[0]
+	Tassert(t, spend.Name == "spend" && free.Name == "free", "got %s %s", spend.Name, free.Name)
+
+	// each leaf keeps its own cash flows
+	for _, leaf := range []*Ast{spend, free} {
+		es := leaf.Timeline.Events()
+		for _, e := range es[len(root.Timeline.Events()):] {
+			Tassert(t, e.Cash == leaf.Period.Cash, "%s event %v", leaf.Name, e.Cash)
+		}
+	}
+
+	want := .5*spend.Path.Npv + .5*free.Path.Npv
+	Tassert(t, math.Abs(root.Expected.Npv-want) < 1e-6, "npv got %v want %v", root.Expected.Npv, want)
+	Tassert(t, math.Abs(root.Expected.Mirr-root.ExpectedTimeline.Mirr()) < 1e-9, "mirr %v", root.Expected.Mirr)
+	avg := .5*spend.Path.Mirr + .5*free.Path.Mirr
+	Tassert(t, math.Abs(root.Expected.Mirr-avg) > .1, "mirr %v is the average", root.Expected.Mirr)
+
+	roots, err = FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	RecalcWith(roots, now, testWarn(t), Options{AverageMirr: true})
+	Tassert(t, math.Abs(roots[0].Expected.Mirr-avg) < 1e-9, "average mirr got %v want %v", roots[0].Expected.Mirr, avg)
+}
+
+func TestExpectedJoint(t *testing.T) {
+	data, err := testFS.ReadFile("examples/pert.yaml")
+	Tassert(t, err == nil, "%v", err)
+	model, err := parseModel(data, "pert.yaml")
+	Tassert(t, err == nil, "%v", err)
+	for name, cash := range map[string]string{"backend": "100", "frontend": "50", "prototype": "120"} {
+		node := model.Nodes[name]
+		node.Cash = cash
+		model.Nodes[name] = node
+	}
+	roots := model.ToAst()
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	nodes := make(map[string]*Ast)
+	for _, root := range roots {
+		root.Walk(func(node *Ast) { nodes[node.Name] = node })
+	}
+
+	// backend and frontend run in parallel, so their cash adds up
+	codeAlt := nodes["code_alt"]
+	want := .5*150 + .5*120
+	Tassert(t, codeAlt.Expected.Cash == want, "cash got %v want %v", codeAlt.Expected.Cash, want)
+	Tassert(t, math.Abs(codeAlt.Expected.Npv-want) < 1e-9, "npv got %v want %v", codeAlt.Expected.Npv, want)
+	Tassert(t, math.Abs(nodes["requirements"].Expected.Npv-want) < 1e-9, "root npv %v", nodes["requirements"].Expected.Npv)
+
+	// and make one outcome together
+	dist := codeAlt.Distribution()
+	Tassert(t, len(dist) == 2, "got %d outcomes", len(dist))
+	joint := dist[1]
+	Tassert(t, joint.Prob == .5 && joint.Npv == 150 && joint.Cash == 150, "joint outcome %+v", joint)
+	Tassert(t, len(joint.Leaves) == 2 && joint.name() == "backend+frontend", "joint leaves %s", joint.name())
+	Tassert(t, joint.End.Equal(nodes["backend"].End), "joint end %v", joint.End)
+	Tassert(t, codeAlt.Risk.VaR == -120, "var %v", codeAlt.Risk.VaR)
+
+	profiles := Profiles(roots)
+	Tassert(t, profiles[0].Name == "requirements" && len(profiles[0].Outcomes) == 2, "profile %+v", profiles[0])
+	Tassert(t, math.Abs(profiles[0].Cdf(150)-1) < 1e-9, "cdf %v", profiles[0].Cdf(150))
+}
+
+func TestExpectedJointPrefix(t *testing.T) {
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, opts := range []Options{{}, {AverageMirr: true}} {
+		roots, err := FromYAML([]byte(jointYAML))
+		Tassert(t, err == nil, "%v", err)
+		RecalcWith(roots, now, testWarn(t), opts)
+		root := roots[0]
+		// -100 + 60 + 60 + (40 - 100) / 2
+		Tassert(t, root.Expected.Cash == -10, "%+v: cash %v", opts, root.Expected.Cash)
+		Tassert(t, math.Abs(root.Expected.Npv+10) < 1e-9, "%+v: npv %v", opts, root.Expected.Npv)
+		total := 0.0
+		for _, e := range root.ExpectedTimeline.Events() {
+			total += e.Cash
+		}
+		Tassert(t, math.Abs(total+10) < 1e-9, "%+v: timeline cash %v", opts, total)
+	}
+}
@@ -2,6 +2,7 @@ package fin
 
 import (
 	"math"
+	"sort"
 	"time"
 	// . "github.com/stevegt/goadapt"
 )
@@ -124,3 +125,58 @@ func (tl *Timeline) Recalc() {
 	// https://en.wikipedia.org/wiki/Modified_internal_rate_of_return
 	tl.mirr = math.Pow(tl.fvpos/tl.pvneg, 1/yearsTotal) - 1
 }
+
+// Clone returns a copy of the timeline that can be extended without
+// touching the original's events.
+func (tl *Timeline) Clone() (c Timeline) {
+	c = *tl
+	c.events = make([]*Event, len(tl.events))
+	for i, e := range tl.events {
+		ec := *e
+		c.events[i] = &ec
+	}
+	return
+}
+
+// Tail returns a copy of the timeline without its first n events,
+// e.g. the ones it shares with the timeline it was cloned from.  The
+// start stays the same, so the remaining events keep their times.
+func (tl *Timeline) Tail(n int) (c *Timeline) {
+	full := tl.Clone()
+	c = &full
+	c.events = c.events[n:]
+	return
+}
+
+// Merge returns the probability-weighted merge of the timelines: each
+// event's cash is scaled by the weight of its timeline, keeping its
+// rates, and the events are ordered by date.  The NPV of the result is
+// the expected NPV of the timelines, and its MIRR is the MIRR of the
+// expected cash flows.
+func Merge(tls []*Timeline, weights []float64) (m *Timeline) {
+	m = &Timeline{}
+	for i, tl := range tls {
+		for _, e := range tl.events {
+			ec := *e
+			ec.Cash *= weights[i]
+			m.events = append(m.events, &ec)
+		}
+		if m.Start.IsZero() || (!tl.Start.IsZero() && tl.Start.Before(m.Start)) {
+			m.Start = tl.Start
+		}
+		if tl.End.After(m.End) {
+			m.End = tl.End
+		}
+	}
+	sort.SliceStable(m.events, func(i, j int) bool {
+		return m.events[i].Date.Before(m.events[j].Date)
+	})
+	for _, e := range m.events {
+		e.T = e.Date.Sub(m.Start)
+		if e.T < 0 {
+			e.T = 0
+		}
+	}
+	m.Recalc()
+	return
+}
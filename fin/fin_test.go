@@ -3,6 +3,7 @@ package fin
 import (
 	"encoding/json"
 	"io/ioutil"
+	"math"
 	"path"
 	"testing"
 	"time"
@@ -71,3 +72,41 @@ func TestAll(t *testing.T) {
 		})
 	}
 }
+
+func TestMerge(t *testing.T) {
+	start := time.Date(2021, 4, 8, 0, 0, 0, 0, time.UTC)
+	year := func(n int) time.Time { return start.AddDate(n, 0, 0) }
+	mk := func(cash ...float64) (tl *Timeline) {
+		tl = &Timeline{}
+		tl.SetFinRate(start, .1)
+		tl.SetReRate(start, .1)
+		for i, c := range cash {
+			tl.Event(year(i), c)
+		}
+		tl.Recalc()
+		return
+	}
+	good := mk(-100, 50, 50, 50)
+	// no negative flows, so the MIRR is infinite
+	bad := mk(0, 10)
+	Tassert(t, math.IsInf(bad.Mirr(), 1), "bad mirr %v", bad.Mirr())
+
+	m := Merge([]*Timeline{good, bad}, []float64{.7, .3})
+	want := .7*good.Npv() + .3*bad.Npv()
+	Tassert(t, math.Abs(m.Npv()-want) < 1e-9, "npv got %v want %v", m.Npv(), want)
+	Tassert(t, !math.IsInf(m.Mirr(), 0) && !math.IsNaN(m.Mirr()), "mirr %v", m.Mirr())
+	Tassert(t, m.End.Equal(year(3)), "end %v", m.End)
+
+	// a clone doesn't share events with the original
+	c := good.Clone()
+	c.Event(year(4), 1000)
+	c.Recalc()
+	Tassert(t, len(good.Events()) == 6, "original has %d events", len(good.Events()))
+	Tassert(t, c.Npv() != good.Npv(), "clone npv %v", c.Npv())
+
+	// the clone's own events, merged with the original, add up to it
+	tail := c.Tail(len(good.Events()))
+	Tassert(t, len(tail.Events()) == 1 && tail.Events()[0].Cash == 1000, "tail %v", tail.Events())
+	m = Merge([]*Timeline{good, tail}, []float64{1, 1})
+	Tassert(t, math.Abs(m.Npv()-c.Npv()) < 1e-9, "npv got %v want %v", m.Npv(), c.Npv())
+}
@@ -0,0 +1,196 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stevegt/godecide/fin"
+)
+
+// A forecast spreads the cash flows of the leaves under a root over
+// calendar periods, so it shows when money goes out and comes in
+// rather than what it's worth today.  The amounts are nominal, not
+// discounted.  Each period has the probability-weighted expected cash
+// and the 10th and 90th percentiles across the outcomes (see
+// LeafOutcome), counting an outcome with nothing in the period as
+// zero.
+
+// Forecast is the cash flow forecast of one root.
+type Forecast struct {
+	Root    string
+	Period  string // month, quarter or year
+	Buckets []Bucket
+}
+
+// Bucket is the cash flow of one calendar period.
+type Bucket struct {
+	Start      time.Time
+	Label      string
+	Expected   float64
+	P10        float64
+	P90        float64
+	Cumulative float64 // expected cash up to the end of the period
+}
+
+// Forecasts returns the cash flow forecast of each root, after Recalc,
+// bucketed by period: "month", "quarter" or "year".
+func Forecasts(roots []*Ast, period string) (forecasts []*Forecast, err error) {
+	switch period {
+	case "month", "quarter", "year":
+	default:
+		return nil, fmt.Errorf("unknown forecast period: %s", period)
+	}
+	for _, root := range roots {
+		forecasts = append(forecasts, forecast(root, period))
+	}
+	return
+}
+
+// timelines returns the cash flows of the outcome's leaves, each
+// without the events another leaf already counts.
+func (o LeafOutcome) timelines() (tls []*fin.Timeline) {
+	for i, leaf := range o.Leaves {
+		tls = append(tls, leaf.Timeline.Tail(o.skip[i]))
+	}
+	return
+}
+
+func forecast(root *Ast, period string) (f *Forecast) {
+	f = &Forecast{Root: root.Name, Period: period}
+	dist := root.Distribution()
+
+	// cash per bucket per outcome
+	cash := make([]map[time.Time]float64, len(dist))
+	var first, last time.Time
+	for i, o := range dist {
+		cash[i] = make(map[time.Time]float64)
+		for _, tl := range o.timelines() {
+			for _, e := range tl.Events() {
+				if e.Cash == 0 {
+					continue
+				}
+				start := bucketStart(e.Date, period)
+				cash[i][start] += e.Cash
+				if first.IsZero() || start.Before(first) {
+					first = start
+				}
+				if start.After(last) {
+					last = start
+				}
+			}
+		}
+	}
+	if first.IsZero() {
+		return
+	}
+
+	cum := 0.0
+	for start := first; !start.After(last); start = nextBucket(start, period) {
+		b := Bucket{Start: start, Label: bucketLabel(start, period)}
+		values := make([]LeafOutcome, len(dist))
+		for i, o := range dist {
+			b.Expected += o.Prob * cash[i][start]
+			values[i] = LeafOutcome{Prob: o.Prob, Cash: cash[i][start]}
+		}
+		sort.SliceStable(values, func(i, j int) bool { return values[i].Cash < values[j].Cash })
+		b.P10 = quantile(values, .1)
+		b.P90 = quantile(values, .9)
+		cum += b.Expected
+		b.Cumulative = cum
+		f.Buckets = append(f.Buckets, b)
+	}
+	return
+}
+
+// quantile returns the smallest cash whose cumulative probability
+// reaches q, from outcomes sorted by cash.
+func quantile(sorted []LeafOutcome, q float64) float64 {
+	cum := 0.0
+	for _, o := range sorted {
+		cum += o.Prob
+		if cum >= q-1e-12 {
+			return o.Cash
+		}
+	}
+	return sorted[len(sorted)-1].Cash
+}
+
+func bucketStart(t time.Time, period string) time.Time {
+	switch period {
+	case "year":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	case "quarter":
+		m := (t.Month()-1)/3*3 + 1
+		return time.Date(t.Year(), m, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func nextBucket(start time.Time, period string) time.Time {
+	switch period {
+	case "year":
+		return start.AddDate(1, 0, 0)
+	case "quarter":
+		return start.AddDate(0, 3, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+func bucketLabel(start time.Time, period string) string {
+	switch period {
+	case "year":
+		return start.Format("2006")
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", start.Year(), (start.Month()-1)/3+1)
+	}
+	return start.Format("2006-01")
+}
+
+// ForecastCSV formats the forecasts as CSV, one row per root and
+// period.
+func ForecastCSV(forecasts []*Forecast) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"root", "period", "expected", "p10", "p90", "cumulative"})
+	for _, f := range forecasts {
+		for _, b := range f.Buckets {
+			w.Write([]string{f.Root, b.Label,
+				fmt.Sprintf("%.2f", b.Expected), fmt.Sprintf("%.2f", b.P10),
+				fmt.Sprintf("%.2f", b.P90), fmt.Sprintf("%.2f", b.Cumulative)})
+		}
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// ForecastSVG charts the expected cash per period of each root, with
+// its P10 and P90 dashed.
+func ForecastSVG(forecasts []*Forecast) []byte {
+	var series []svgSeries
+	period := "month"
+	for _, f := range forecasts {
+		period = f.Period
+		expected := svgSeries{Name: f.Root, Step: true}
+		p10 := svgSeries{Name: f.Root + " P10", Step: true, Dashed: true}
+		p90 := svgSeries{Name: f.Root + " P90", Step: true, Dashed: true}
+		for _, b := range f.Buckets {
+			x := float64(b.Start.Unix())
+			expected.X, expected.Y = append(expected.X, x), append(expected.Y, b.Expected)
+			p10.X, p10.Y = append(p10.X, x), append(p10.Y, b.P10)
+			p90.X, p90.Y = append(p90.X, x), append(p90.Y, b.P90)
+		}
+		// close the last period
+		if n := len(f.Buckets); n > 0 {
+			x := float64(nextBucket(f.Buckets[n-1].Start, period).Unix())
+			for _, s := range []*svgSeries{&expected, &p10, &p90} {
+				s.X, s.Y = append(s.X, x), append(s.Y, s.Y[n-1])
+			}
+		}
+		series = append(series, expected, p10, p90)
+	}
+	xfmt := func(x float64) string { return bucketLabel(time.Unix(int64(x), 0).UTC(), period) }
+	return svgChart("expected cash flow per "+period, period, "cash", series, xfmt, form)
+}
@@ -0,0 +1,80 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestForecast(t *testing.T) {
+	src := `
+launch:
+  cash: -1000
+  days: 30
+  paths:
+    hit: .25
+    miss: .75
+hit:
+  cash: 400
+  days: 90
+  repeat: 4
+miss:
+  cash: 40
+  days: 90
+`
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, now, testWarn(t))
+
+	fs, err := Forecasts(roots, "quarter")
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, len(fs) == 1, "got %d forecasts", len(fs))
+	var labels []string
+	for _, b := range fs[0].Buckets {
+		labels = append(labels, b.Label)
+	}
+	got := strings.Join(labels, " ")
+	Tassert(t, got == "2023-Q1 2023-Q2 2023-Q3 2023-Q4 2024-Q1", "got %s", got)
+
+	// launch at the end of January, then hit pays 400 per quarter
+	// while miss pays 40 once
+	q1, q2 := fs[0].Buckets[0], fs[0].Buckets[1]
+	Tassert(t, q1.Expected == -1000 && q1.P10 == -1000 && q1.P90 == -1000, "q1 %v", q1)
+	Tassert(t, math.Abs(q2.Expected-(.25*400+.75*40)) < 1e-9, "q2 expected %v", q2.Expected)
+	Tassert(t, q2.P10 == 40 && q2.P90 == 400, "q2 p10 %v p90 %v", q2.P10, q2.P90)
+	q3 := fs[0].Buckets[2]
+	Tassert(t, q3.P10 == 0 && q3.P90 == 400, "q3 p10 %v p90 %v", q3.P10, q3.P90)
+	last := fs[0].Buckets[len(fs[0].Buckets)-1]
+	want := .25*(1600-1000) + .75*(40-1000)
+	Tassert(t, math.Abs(last.Cumulative-want) < 1e-9, "cumulative %v want %v", last.Cumulative, want)
+
+	csv := string(ForecastCSV(fs))
+	Tassert(t, strings.HasPrefix(csv, "root,period,expected,p10,p90,cumulative\nlaunch,2023-Q1,-1000.00,"), "got %s", csv)
+	svg := string(ForecastSVG(fs))
+	Tassert(t, strings.Count(svg, "<polyline") == 3, "got %s", svg)
+
+	_, err = Forecasts(roots, "week")
+	Tassert(t, err != nil, "expected error for unknown period")
+}
+
+func TestForecastJoint(t *testing.T) {
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	roots, err := FromYAML([]byte(jointYAML))
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, now, testWarn(t))
+	fs, err := Forecasts(roots, "month")
+	Tassert(t, err == nil, "%v", err)
+
+	// the root's cash shows up once, and a and b add up
+	var got []string
+	for _, b := range fs[0].Buckets {
+		got = append(got, Spf("%s:%v/%v/%v", b.Label, b.Expected, b.P10, b.P90))
+	}
+	want := "2023-01:-100/-100/-100 2023-02:0/0/0 2023-03:120/120/120 2023-04:-30/-100/40"
+	Tassert(t, strings.Join(got, " ") == want, "got %v", got)
+	Tassert(t, fs[0].Buckets[len(fs[0].Buckets)-1].Cumulative == -10, "cumulative %v", fs[0].Buckets)
+}
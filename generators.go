@@ -0,0 +1,351 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"gopkg.in/yaml.v2"
+)
+
+// Generators expand symmetric subtrees so they don't have to be
+// written out by hand.  A node with `uncertainties:` gets one child
+// per combination of outcomes, with the outcome probabilities
+// multiplied:
+//
+//	launch:
+//	  cash: -1M
+//	  uncertainties:
+//	    - demand: {high: .6, low: .4}
+//	    - price: {up: .5, down: .5}
+//	  each:
+//	    cash: 2M * demand_high + 500k * demand_low + 300k * price_up
+//	    days: 365
+//
+// Here `launch` gets the children `launch/high/up` (p = .3),
+// `launch/high/down`, `launch/low/up` and `launch/low/down`.  Each
+// child is a copy of `each:`, with a var `name_outcome` that is 1 for
+// the outcomes it stands for and 0 for the others.  An outcome's
+// probability can be an expression, or `rest`.  An entry can also be
+// just the name of a model-level uncertainty (see uncertainties.go).
+// The children continue to the node's own `paths:` unless `each:` has
+// paths of its own.
+//
+// A node with `for: var in lo..hi` is expanded to a chain of copies,
+// one per value, with the value in the node-local var:
+//
+//	rent:
+//	  for: year in 1..10
+//	  cash: -12k * 1.03**(year-1)
+//	  days: 365
+//
+// The first copy keeps the node's name and the others are named
+// `rent/2` ... `rent/10`; the last one continues to the node's
+// `paths:`.  A node can have both `for:` and `uncertainties:`, in
+// which case every step of the chain branches.  The bounds can use
+// params but not references to other nodes (see refs.go), which are
+// resolved after the chain is built.
+
+// Uncertainty is a chance event with named, mutually exclusive
+// outcomes.
+type Uncertainty struct {
+	Name     string
+	Outcomes []Outcome
+}
+
+// Outcome is one outcome of an Uncertainty and its probability
+// expression.
+type Outcome struct {
+	Name string
+	Prob string
+}
+
+// Uncertainties is a list of independent uncertainties.  In YAML each
+// entry is a single `name: {outcome: prob, ...}` map, so the order of
+// outcomes is kept.
+type Uncertainties []Uncertainty
+
+// UnmarshalYAML reads a `name: {outcome: prob, ...}` entry, or just
+// the name of a model-level uncertainty.
+func (u *Uncertainty) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	if unmarshal(&u.Name) == nil {
+		// a reference to a model-level uncertainty
+		return
+	}
+	var entry yaml.MapSlice
+	err = unmarshal(&entry)
+	if err != nil {
+		return
+	}
+	if len(entry) != 1 {
+		return fmt.Errorf("uncertainty: want a single name: {outcome: prob, ...} entry, got %v", entry)
+	}
+	*u, err = uncertaintyFrom(entry[0])
+	return
+}
+
+// uncertaintyFrom converts a `name: {outcome: prob, ...}` item.
+func uncertaintyFrom(item yaml.MapItem) (u Uncertainty, err error) {
+	u.Name = fmt.Sprint(item.Key)
+	outcomes, ok := item.Value.(yaml.MapSlice)
+	if !ok {
+		err = fmt.Errorf("uncertainty %s: want a map of outcomes to probabilities", u.Name)
+		return
+	}
+	for _, o := range outcomes {
+		u.Outcomes = append(u.Outcomes, Outcome{Name: fmt.Sprint(o.Key), Prob: fmt.Sprint(o.Value)})
+	}
+	return
+}
+
+// MarshalYAML writes the `name: {outcome: prob, ...}` form.
+func (u Uncertainty) MarshalYAML() (interface{}, error) {
+	if len(u.Outcomes) == 0 {
+		return u.Name, nil
+	}
+	var outcomes yaml.MapSlice
+	for _, o := range u.Outcomes {
+		outcomes = append(outcomes, yaml.MapItem{Key: o.Name, Value: o.Prob})
+	}
+	return yaml.MapSlice{{Key: u.Name, Value: outcomes}}, nil
+}
+
+// check validates the uncertainty and returns its outcome probability
+// expressions, with any `rest` replaced by the remainder.
+func (u Uncertainty) check() (probs []string, err error) {
+	if !identRe.MatchString(u.Name) {
+		return nil, fmt.Errorf("invalid name: %q", u.Name)
+	}
+	if len(u.Outcomes) == 0 {
+		return nil, fmt.Errorf("%s has no outcomes", u.Name)
+	}
+	seen := make(map[string]bool)
+	for _, o := range u.Outcomes {
+		if !identRe.MatchString(o.Name) {
+			return nil, fmt.Errorf("%s: invalid outcome: %q", u.Name, o.Name)
+		}
+		if seen[o.Name] {
+			return nil, fmt.Errorf("%s: duplicate outcome: %s", u.Name, o.Name)
+		}
+		seen[o.Name] = true
+	}
+	rest := -1
+	var others []string
+	for i, o := range u.Outcomes {
+		switch strings.TrimSpace(o.Prob) {
+		case "rest", "else":
+			if rest >= 0 {
+				return nil, fmt.Errorf("%s: more than one rest outcome", u.Name)
+			}
+			rest = i
+			probs = append(probs, "")
+		default:
+			probs = append(probs, Spf("(%s)", o.Prob))
+			others = append(others, Spf("(%s)", o.Prob))
+		}
+	}
+	if rest >= 0 {
+		probs[rest] = Spf("(1 - %s)", strings.Join(others, " - "))
+		if len(others) == 0 {
+			probs[rest] = "1"
+		}
+	}
+	return
+}
+
+// maxSteps limits the length of a `for:` chain.
+const maxSteps = 10000
+
+var forRe = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s+in\s+(.+?)\s*\.\.\s*(.+?)\s*$`)
+
+// expandGenerators expands the working nodes that have `for:`,
+// `hazard:` or `uncertainties:`.
+func (m *Model) expandGenerators() (err error) {
+	for _, name := range m.nodeNames(func(node Node) bool { return node.For != "" }) {
+		err = m.expandFor(name)
+		if err != nil {
+			return
+		}
+	}
+	for _, name := range m.nodeNames(func(node Node) bool { return node.Hazard != "" }) {
+		err = m.expandHazard(name)
+		if err != nil {
+			return
+		}
+	}
+	for _, name := range m.nodeNames(func(node Node) bool { return len(node.Uncertainties) > 0 }) {
+		err = m.expandUncertainties(name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// nodeNames returns the sorted names of the working nodes that match.
+func (m *Model) nodeNames(match func(node Node) bool) (names []string) {
+	for name, node := range m.nodes {
+		if match(node) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// expandFor replaces the named node with a chain of steps.
+func (m *Model) expandFor(name string) (err error) {
+	node := m.nodes[name]
+	match := forRe.FindStringSubmatch(node.For)
+	if match == nil {
+		return fmt.Errorf("%s: for: want `var in lo..hi`, got %q", name, node.For)
+	}
+	v := match[1]
+	var bounds [2]int
+	for i, expr := range match[2:] {
+		err = m.noRefs(expr)
+		if err != nil {
+			return fmt.Errorf("%s: for: %v", name, err)
+		}
+		var f float64
+		f, err = evalFloat(expr, m.vars)
+		if err != nil {
+			return fmt.Errorf("%s: for: %v", name, err)
+		}
+		if f != math.Trunc(f) {
+			return fmt.Errorf("%s: for: bound is not an integer: %s = %v", name, expr, f)
+		}
+		bounds[i] = int(f)
+	}
+	lo, hi := bounds[0], bounds[1]
+	if hi < lo || hi-lo >= maxSteps {
+		return fmt.Errorf("%s: for: invalid range %d..%d", name, lo, hi)
+	}
+
+	stepName := func(i int) string {
+		if i == lo {
+			return name
+		}
+		return Spf("%s/%d", name, i)
+	}
+	cont := node.Paths
+	node.For = ""
+	for i := lo; i <= hi; i++ {
+		step := node
+		step.Vars = map[string]string{v: Spf("%d", i)}
+		for k, expr := range node.Vars {
+			if k != v {
+				step.Vars[k] = expr
+			}
+		}
+		step.Paths = cont
+		if i < hi {
+			step.Paths = Paths{stepName(i + 1): "1"}
+		}
+		if i > lo {
+			if _, ok := m.nodes[stepName(i)]; ok {
+				return fmt.Errorf("%s: for: %s collides with an existing node", name, stepName(i))
+			}
+		}
+		m.nodes[stepName(i)] = step
+	}
+	return
+}
+
+// expandUncertainties gives the named node one child per combination
+// of outcomes.
+func (m *Model) expandUncertainties(name string) (err error) {
+	node := m.nodes[name]
+	var dims Uncertainties
+	var probs [][]string
+	for _, u := range node.Uncertainties {
+		if len(u.Outcomes) == 0 {
+			// a reference to a model-level uncertainty
+			shared, ok := m.uncertainty(u.Name)
+			if !ok {
+				return fmt.Errorf("%s: uncertainties: no such uncertainty: %s", name, u.Name)
+			}
+			u = shared
+		}
+		var p []string
+		p, err = u.check()
+		if err != nil {
+			return fmt.Errorf("%s: uncertainties: %v", name, err)
+		}
+		dims = append(dims, u)
+		probs = append(probs, p)
+	}
+
+	var each Node
+	if node.Each != nil {
+		each, err = m.inherit(*node.Each, []string{name + "/each"})
+		if err != nil {
+			return
+		}
+	}
+	cont := node.Paths
+	node.Paths = make(Paths)
+
+	// walk the combinations like an odometer
+	pick := make([]int, len(dims))
+	for {
+		var outcomes, labels, factors []string
+		event := make(map[string]string)
+		vars := make(map[string]string)
+		for k, expr := range node.Vars {
+			vars[k] = expr
+		}
+		for d, u := range dims {
+			o := u.Outcomes[pick[d]]
+			outcomes = append(outcomes, o.Name)
+			labels = append(labels, Spf("%s=%s", u.Name, o.Name))
+			event[u.Name] = o.Name
+			factors = append(factors, probs[d][pick[d]])
+			for i, other := range u.Outcomes {
+				flag := "0"
+				if i == pick[d] {
+					flag = "1"
+				}
+				vars[u.Name+"_"+other.Name] = flag
+			}
+		}
+		for k, expr := range each.Vars {
+			vars[k] = expr
+		}
+		child := each
+		child.Vars = vars
+		if child.Desc == "" {
+			child.Desc = strings.Join(labels, ", ")
+		}
+		if child.Paths == nil {
+			child.Paths = cont
+		}
+		childName := name + "/" + strings.Join(outcomes, "/")
+		if _, ok := m.nodes[childName]; ok {
+			return fmt.Errorf("%s: uncertainties: %s collides with an existing node", name, childName)
+		}
+		m.nodes[childName] = child
+		node.Paths[childName] = strings.Join(factors, " * ")
+		m.setOutcomes(name, childName, event)
+
+		// next combination
+		d := len(dims) - 1
+		for ; d >= 0; d-- {
+			pick[d]++
+			if pick[d] < len(dims[d].Outcomes) {
+				break
+			}
+			pick[d] = 0
+		}
+		if d < 0 {
+			break
+		}
+	}
+	node.Uncertainties = nil
+	node.Each = nil
+	m.nodes[name] = node
+	return
+}
@@ -0,0 +1,93 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestUncertainties(t *testing.T) {
+	buf := []byte(`
+params:
+  p_high: .6
+launch:
+  cash: -1M
+  uncertainties:
+    - demand: {high: p_high, low: rest}
+    - price: {up: .5, down: .5}
+  each:
+    cash: 2M * demand_high + 500k * demand_low + 300k * price_up
+    days: 365
+  paths:
+    wrapup: 1
+wrapup:
+  cash: -10k
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, len(roots) == 1, "roots %d", len(roots))
+	root := roots[0]
+	Tassert(t, len(root.Hyperedges) == 4, "hyperedges %d", len(root.Hyperedges))
+	want := map[string][2]float64{
+		"launch/high/down": {.3, 2e6},
+		"launch/high/up":   {.3, 2.3e6},
+		"launch/low/down":  {.2, 5e5},
+		"launch/low/up":    {.2, 8e5},
+	}
+	for _, hedge := range root.Hyperedges {
+		child := hedge.Children[0]
+		w, ok := want[child.Name]
+		Tassert(t, ok, "unexpected child %s", child.Name)
+		Tassert(t, math.Abs(hedge.Prob-w[0]) < 1e-9, "%s prob %v", child.Name, hedge.Prob)
+		Tassert(t, child.Node.Cash == w[1], "%s cash %v", child.Name, child.Node.Cash)
+		Tassert(t, child.Hyperedges[0].Children[0].Name == "wrapup", "%s continues to %s", child.Name, child.Hyperedges[0].Path)
+	}
+	Tassert(t, root.Hyperedges[0].Children[0].Desc == "demand=high, price=down", "desc %q", root.Hyperedges[0].Children[0].Desc)
+}
+
+func TestFor(t *testing.T) {
+	buf := []byte(`
+params:
+  years: 3
+lease:
+  paths:
+    rent: 1
+rent:
+  for: year in 1..years
+  cash: -12k * 2**(year-1)
+  days: 365
+  paths:
+    done: 1
+done:
+  desc: lease ends
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	node := roots[0].Hyperedges[0].Children[0]
+	for i, name := range []string{"rent", "rent/2", "rent/3"} {
+		Tassert(t, node.Name == name, "step %d: %s", i, node.Name)
+		Tassert(t, node.Node.Cash == -12000*float64(int(1)<<i), "%s cash %v", name, node.Node.Cash)
+		node = node.Hyperedges[0].Children[0]
+	}
+	Tassert(t, node.Name == "done", "chain ends at %s", node.Name)
+	Tassert(t, node.Path.Cash == -84000, "path cash %v", node.Path.Cash)
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	cases := map[string]string{
+		"a:\n  for: year from 1 to 3\n":                       "want `var in lo..hi`",
+		"a:\n  for: i in 3..1\n":                              "invalid range",
+		"a:\n  for: i in 1..b.repeat\nb:\n  repeat: 3\n":      "can't refer to b.repeat",
+		"a:\n  uncertainties:\n    - d: {x: rest, y: rest}\n": "more than one rest",
+		"a:\n  uncertainties:\n    - d: {x-1: .5, y: .5}\n":   "invalid outcome",
+	}
+	for yml, want := range cases {
+		_, err := FromYAML([]byte(yml))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: want %q, got %v", yml, want, err)
+	}
+}
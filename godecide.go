@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"embed"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
 	"regexp"
@@ -14,7 +15,6 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/goccy/go-graphviz"
 	"github.com/goccy/go-graphviz/cgraph"
-	"github.com/soudy/mathcat"
 	. "github.com/stevegt/goadapt"
 	"github.com/stevegt/godecide/fin"
 
@@ -27,18 +27,42 @@ var ExamplesFS embed.FS
 type Warn func(args ...interface{})
 
 type Node struct {
-	Desc    string
-	Cash    string
-	Days    string
-	Repeat  string
-	FinRate float64
-	ReRate  float64
-	Due     time.Time
-	Paths   Paths    `yaml:",omitempty"`
-	Prereqs []string `yaml:",omitempty"`
+	Extends       string `yaml:",omitempty"`
+	Use           string `yaml:",omitempty"`
+	For           string `yaml:"for,omitempty"`
+	Decision      bool   `yaml:",omitempty"`
+	Desc          string
+	Cash          string
+	Days          string
+	Workdays      string `yaml:",omitempty"`
+	Repeat        string
+	Hazard        string `yaml:",omitempty"`
+	OnFail        string `yaml:"onFail,omitempty"`
+	FinRate       float64
+	ReRate        float64
+	Due           string
+	NotBefore     string            `yaml:"notBefore,omitempty"`
+	Vars          map[string]string `yaml:",omitempty"`
+	Set           map[string]string `yaml:",omitempty"`
+	When          string            `yaml:",omitempty"`
+	Uncertainties Uncertainties     `yaml:",omitempty"`
+	Each          *Node             `yaml:",omitempty"`
+	Markov        *Markov           `yaml:",omitempty"`
+	Attrs         map[string]string `yaml:",omitempty"`
+	Resources     map[string]string `yaml:",omitempty"`
+	Paths         Paths             `yaml:",omitempty"`
+	Prereqs       []string          `yaml:",omitempty"`
+	// the keys given in the YAML, so that an explicit zero can
+	// override a template
+	set map[string]bool
 }
 
-type Paths map[string]float64
+// Paths maps a comma-separated list of child names to the
+// probability of taking that path.  A probability is a mathcat
+// expression that can use params, e.g. `1/3` or `p_success * 0.8`;
+// at most one path per node can be `rest` (or `else`) to take
+// whatever probability remains.
+type Paths map[string]string
 
 type Nodes map[string]Node
 
@@ -47,54 +71,90 @@ type Stats struct {
 	Cash     float64
 	Npv      float64
 	Mirr     float64
+	Attrs    map[string]float64
+	Score    float64
+	Variance float64 // of the duration, in days squared
+	// with a budget, the running cash balance and its low point
+	Balance    float64
+	MinBalance float64
 }
 
 type Ast struct {
-	Name       string
-	Desc       string
-	Repeat     int
-	FinRate    float64
-	ReRate     float64
-	Period     Stats
-	Node       Stats
-	Path       Stats
-	Expected   Stats
-	Start      time.Time
-	End        time.Time
-	Due        time.Time
-	Timeline   fin.Timeline
-	Critical   bool
-	Hyperedges []*Hyperedge
+	Name      string
+	Desc      string
+	Decision  bool
+	Repeat    int
+	Workdays  int
+	Calendar  *Calendar
+	FinRate   float64
+	ReRate    float64
+	Period    Stats
+	Node      Stats
+	Path      Stats
+	Expected  Stats
+	Risk      Risk
+	Start     time.Time
+	End       time.Time
+	Due       time.Time
+	DueRef    DateRef
+	NotBefore DateRef
+	Idle      time.Duration
+	RootStart time.Time
+	State     Vars
+	Timeline  fin.Timeline
+	// the probability-weighted merge of the leaf timelines, after Backward
+	ExpectedTimeline *fin.Timeline
+	Flows            []float64 // per-period cash, if it varies
+	Reach            float64   // probability of reaching the node from its root
+	Float            time.Duration
+	LateStart        time.Time
+	LateFinish       time.Time
+	Critical         bool
+	Resources        map[string]float64 // used while the node runs
+	LevelStart       time.Time          // when leveling makes the node wait until
+	POnTime          float64            // probability of ending by Due
+	Late             bool               // this node or one before it missed its due date
+	Broke            bool               // the balance dropped below the credit line here or before
+	Hyperedges       []*Hyperedge
+
+	dist      []LeafOutcome
+	brokeHere bool
+	src       Node
+	vars      Vars
+	model     *Model
+	opts      Options
 }
 
 type Hyperedge struct {
 	Prob     float64
+	Path     string
+	Outcomes map[string]string // uncertainty -> outcome, if known
 	Parents  []*Ast
 	Children []*Ast
 }
 
+// FromYAML converts the model in buf to Ast trees.  There is no
+// model file for relative paths to start from, so included files and
+// the holiday file must be given as absolute paths; see FromYAMLIn.
 func FromYAML(buf []byte) (roots []*Ast, err error) {
+	return FromYAMLIn(buf, "")
+}
+
+// FromYAMLIn is like FromYAML, but reads relative paths from dir.
+func FromYAMLIn(buf []byte, dir string) (roots []*Ast, err error) {
 	defer Return(&err)
-	var nodes Nodes
-	err = yaml.Unmarshal(buf, &nodes)
+	model, err := parseModel(buf, "stdin")
 	Ck(err)
-	roots = nodes.ToAst()
+	err = model.include(dir, ioutil.ReadFile, []string{"stdin"})
+	Ck(err)
+	roots = model.ToAst()
 	return
 }
 
+// ToAst converts the nodes to Ast trees using a default model.
 func (nodes Nodes) ToAst() (roots []*Ast) {
-	// get the root nodes (as a map)
-	rootNodes := nodes.RootNodes()
-	var rootNames []string
-	for name := range rootNodes {
-		rootNames = append(rootNames, name)
-	}
-	sort.Strings(rootNames)
-	for _, name := range rootNames {
-		root := nodes.toAst(name)
-		roots = append(roots, root)
-	}
-	return
+	model := &Model{Nodes: nodes}
+	return model.ToAst()
 }
 
 func (nodes Nodes) ToYAML() (buf []byte, err error) {
@@ -140,38 +200,47 @@ func dieif(cond bool, args ...interface{}) {
 	os.Exit(1)
 }
 
-func (nodes Nodes) toAst(name string) (nodeAst *Ast) {
-	node, ok := nodes[name]
+func (m *Model) toAst(name string) (nodeAst *Ast) {
+	node, ok := m.nodes[name]
 	dieif(!ok, "missing node: %s", name)
 
-	cashrat, err := mathcat.Eval(node.Cash)
-	dieif(err != nil, err)
-	cash, _ := cashrat.Float64()
+	due, err := ParseDateRef(node.Due)
+	dieif(err != nil, "%s: due: %v", name, err)
 
-	daysrat, err := mathcat.Eval(node.Days)
-	dieif(err != nil, err)
-	days, _ := daysrat.Float64()
+	notBefore, err := ParseDateRef(node.NotBefore)
+	dieif(err != nil, "%s: notBefore: %v", name, err)
 
-	repeatrat, err := mathcat.Eval(node.Repeat)
-	dieif(err != nil, err)
-	dieif(!(repeatrat.IsInt() && repeatrat.Denom().Int64() == 1), "repeat must evaluate to int: %s", node)
-	repeat := int(repeatrat.Num().Int64())
-	repeat = int(math.Max(1, float64(repeat)))
+	for _, join := range prereqJoins(node.Prereqs) {
+		for _, prereq := range join {
+			_, ok := m.nodes[prereq]
+			dieif(!ok, "%s: prereqs: missing node: %s", name, prereq)
+		}
+	}
 
 	nodeAst = &Ast{
-		Name:   name,
-		Desc:   node.Desc,
-		Repeat: repeat,
-		Period: Stats{
-			Cash:     cash,
-			Duration: time.Duration(days) * 24 * time.Hour,
-		},
-		Due:     node.Due,
-		FinRate: node.FinRate,
-		ReRate:  node.ReRate,
-	}
-	nodeAst.Node.Cash = nodeAst.Period.Cash * float64(nodeAst.Repeat)
-	nodeAst.Node.Duration = nodeAst.Period.Duration * time.Duration(nodeAst.Repeat)
+		Name:      name,
+		Desc:      node.Desc,
+		Decision:  node.Decision,
+		Calendar:  m.calendar,
+		DueRef:    due,
+		NotBefore: notBefore,
+		FinRate:   node.FinRate,
+		ReRate:    node.ReRate,
+		src:       node,
+		model:     m,
+	}
+	nodeAst.vars, err = resolveVars("vars", node.Vars, m.vars)
+	dieif(err != nil, "%s: %v", name, err)
+
+	// evaluate with the initial state; nodes are re-evaluated
+	// with the path's state during Forward
+	vars := nodeAst.vars.With(m.state)
+	err = nodeAst.eval(vars)
+	dieif(err != nil, "%s: %v", name, err)
+	_, err = evalFloat(node.When, vars)
+	dieif(err != nil, "%s: when: %v", name, err)
+	_, err = nodeAst.applySet(vars, m.state)
+	dieif(err != nil, "%s: %v", name, err)
 
 	// Build hyperedges for each child from the YAML Paths map in a deterministic order.
 
@@ -182,16 +251,21 @@ func (nodes Nodes) toAst(name string) (nodeAst *Ast) {
 	}
 	sort.Strings(pathKeys)
 
+	probs, err := node.Paths.Probs(vars)
+	dieif(err != nil, "%s: paths: %v", name, err)
+
 	for _, pathKey := range pathKeys {
-		pathProb := node.Paths[pathKey]
+		pathProb := probs[pathKey]
 		// split the path key into child names
 		childNames := strings.Split(pathKey, ",")
 		hyperedge := &Hyperedge{
-			Prob:    pathProb,
-			Parents: []*Ast{nodeAst},
+			Prob:     pathProb,
+			Path:     pathKey,
+			Outcomes: m.outcomes[name+"\x00"+pathKey],
+			Parents:  []*Ast{nodeAst},
 		}
 		for _, childName := range childNames {
-			childAst := nodes.toAst(childName)
+			childAst := m.toAst(childName)
 			// Each hyperedge contains a slice of children.
 			hyperedge.Children = append(hyperedge.Children, childAst)
 		}
@@ -200,17 +274,206 @@ func (nodes Nodes) toAst(name string) (nodeAst *Ast) {
 	return
 }
 
+// eval sets the node's period and node stats from its cash, days,
+// workdays and repeat expressions.
+func (a *Ast) eval(vars Vars) (err error) {
+	node := a.src
+
+	cash, err := evalAmount(node.Cash, vars)
+	if err != nil {
+		return fmt.Errorf("cash: %v", err)
+	}
+
+	days, variance, err := evalPert(node.Days, vars)
+	if err != nil {
+		return fmt.Errorf("days: %v", err)
+	}
+
+	workdays, err := evalFloat(node.Workdays, vars)
+	if err != nil {
+		return fmt.Errorf("workdays: %v", err)
+	}
+	if workdays != 0 && days != 0 {
+		return fmt.Errorf("days and workdays are mutually exclusive")
+	}
+
+	repeatrat, err := evalRat(node.Repeat, vars)
+	if err != nil {
+		return fmt.Errorf("repeat: %v", err)
+	}
+	if !(repeatrat.IsInt() && repeatrat.Denom().Int64() == 1) {
+		return fmt.Errorf("repeat must evaluate to int: %s", node.Repeat)
+	}
+	repeat := int(repeatrat.Num().Int64())
+	repeat = int(math.Max(1, float64(repeat)))
+
+	a.Repeat = repeat
+	a.Workdays = int(workdays)
+	a.Period.Cash = cash
+	a.Period.Duration = time.Duration(days * float64(24*time.Hour))
+	a.Node.Cash = a.Period.Cash * float64(a.Repeat)
+	a.Node.Duration = a.Period.Duration * time.Duration(a.Repeat)
+	a.Period.Variance = variance
+	a.Node.Variance = variance * float64(a.Repeat)
+
+	a.Flows = nil
+	if node.Markov != nil {
+		a.Flows, err = node.Markov.flows(vars, a.Repeat)
+		if err != nil {
+			return fmt.Errorf("markov: %v", err)
+		}
+		for i := range a.Flows {
+			a.Flows[i] += cash
+		}
+		a.Node.Cash = 0
+		for _, flow := range a.Flows {
+			a.Node.Cash += flow
+		}
+		a.Period.Cash = a.Node.Cash / float64(a.Repeat)
+	}
+	err = a.evalAttrs(vars)
+	if err != nil {
+		return
+	}
+	return a.evalResources(vars)
+}
+
+// Probs evaluates the path probabilities.
+func (paths Paths) Probs(vars Vars) (probs map[string]float64, err error) {
+	probs = make(map[string]float64)
+	var restKey string
+	total := 0.0
+	for pathKey, expr := range paths {
+		switch strings.ToLower(strings.TrimSpace(expr)) {
+		case "rest", "else":
+			if restKey != "" {
+				err = fmt.Errorf("more than one rest path: %s, %s", restKey, pathKey)
+				return
+			}
+			restKey = pathKey
+			continue
+		}
+		var prob float64
+		prob, err = evalFloat(expr, vars)
+		if err != nil {
+			err = fmt.Errorf("%s: %q: %v", pathKey, expr, err)
+			return
+		}
+		probs[pathKey] = prob
+		total += prob
+	}
+	if restKey != "" {
+		rest := 1 - total
+		if rest < -.001 {
+			err = fmt.Errorf("%s: no probability left for rest: total %.3f", restKey, total)
+			return
+		}
+		probs[restKey] = math.Max(0, rest)
+	}
+	return
+}
+
 // calculate .Path.*
 func (this *Ast) Forward(parent *Ast, now time.Time, warn Warn) {
+	this.Expected = Stats{}
+	this.Idle = 0
+	this.brokeHere = false
 	if parent != nil {
-		this.Timeline = parent.Timeline
+		this.opts = parent.opts
+		// siblings each extend their own copy of the path so far
+		this.Timeline = parent.Timeline.Clone()
 		this.Path.Cash = parent.Path.Cash
+		this.Path.Attrs = copyAttrs(parent.Path.Attrs)
 		this.Path.Duration = parent.Path.Duration
+		this.Path.Variance = parent.Path.Variance
+		this.Path.Balance = parent.Path.Balance
+		this.Path.MinBalance = parent.Path.MinBalance
+		this.Broke = parent.Broke
+		this.RootStart = parent.RootStart
+		this.State = parent.State
+		this.Late = parent.Late
+	} else {
+		this.Path = Stats{}
+		this.startBalance()
+		this.Reach = 1
+		this.Late = false
+		this.Broke = false
+		this.Timeline = fin.Timeline{}
+		if this.model != nil {
+			this.State = this.model.state
+		}
+	}
+
+	// with state, the node's expressions depend on how it was reached
+	if this.model.stateful() {
+		vars := this.vars.With(this.State)
+		err := this.eval(vars)
+		dieif(err != nil, "%s: %v", this.Name, err)
+		this.State, err = this.applySet(vars, this.State)
+		dieif(err != nil, "%s: %v", this.Name, err)
+		err = this.choosePaths()
+		dieif(err != nil, "%s: %v", this.Name, err)
 	}
 
 	this.Start = now.Add(this.Path.Duration)
+	if parent == nil {
+		this.RootStart = this.Start
+	}
+
+	// wait for notBefore, carrying the idle time down the path
+	if !this.NotBefore.IsZero() {
+		notBefore := this.NotBefore.Resolve(now, this.RootStart)
+		if notBefore.After(this.Start) {
+			this.Idle = notBefore.Sub(this.Start)
+			this.Path.Duration += this.Idle
+			this.Start = notBefore
+		}
+		if parent == nil {
+			this.RootStart = this.Start
+		}
+	}
+	// wait for the prereq joins, and for leveling
+	wait := this.prereqStart()
+	if this.LevelStart.After(wait) {
+		wait = this.LevelStart
+	}
+	if wait.After(this.Start) {
+		this.Idle += wait.Sub(this.Start)
+		this.Path.Duration += wait.Sub(this.Start)
+		this.Start = wait
+		if parent == nil {
+			this.RootStart = this.Start
+		}
+	}
+	if !this.DueRef.IsZero() {
+		this.Due = this.DueRef.Resolve(now, this.RootStart)
+	}
+
+	// workdays nodes start on the next working day and skip
+	// weekends and holidays, so their length depends on the start
+	var dates []time.Time
+	if this.Workdays > 0 {
+		workStart := this.Calendar.NextWorkday(this.Start)
+		this.Idle += workStart.Sub(this.Start)
+		this.Path.Duration += workStart.Sub(this.Start)
+		this.Start = workStart
+		date := this.Start
+		for i := 1; i <= this.Repeat; i++ {
+			date = this.Calendar.AddWorkdays(date, this.Workdays)
+			dates = append(dates, date)
+		}
+		this.Node.Duration = date.Sub(this.Start)
+		this.Period.Duration = this.Node.Duration / time.Duration(this.Repeat)
+	} else {
+		for i := 1; i <= this.Repeat; i++ {
+			dates = append(dates, this.Start.Add(time.Duration(i)*this.Period.Duration))
+		}
+	}
+
 	this.Path.Cash += this.Node.Cash
+	this.Path.Attrs = addAttrs(this.Path.Attrs, this.Node.Attrs, 1)
 	this.Path.Duration += this.Node.Duration
+	this.Path.Variance += this.Node.Variance
 	this.End = now.Add(this.Path.Duration)
 
 	if this.FinRate != 0 {
@@ -219,21 +482,35 @@ func (this *Ast) Forward(parent *Ast, now time.Time, warn Warn) {
 	if this.ReRate != 0 {
 		this.Timeline.SetReRate(this.Start, this.ReRate)
 	}
-	for i := 1; i <= this.Repeat; i++ {
-		var date time.Time
-		date = this.Start.Add(time.Duration(i) * this.Period.Duration)
-		this.Timeline.Event(date, this.Period.Cash)
+	for i, date := range dates {
+		this.Timeline.Event(date, this.periodCash(i))
+		this.spend(date, this.periodCash(i), warn)
 	}
 	this.Timeline.Recalc()
 	this.Path.Npv = this.Timeline.Npv()
 	this.Path.Mirr = this.Timeline.Mirr()
+	this.Node.Score = this.model.score(this.Node)
+	this.Path.Score = this.model.score(this.Path)
+	if !this.Due.IsZero() {
+		this.POnTime = onTime(this.End, this.Due, this.Path.Variance)
+	}
 	if !this.Due.IsZero() && this.End.After(this.Due) {
-		warn("late: %s end %s due %s\n", this.Name, this.End, this.Due)
+		if this.Path.Variance > 0 {
+			warn("late: %s end %s due %s p(on time) %.2f\n", this.Name, this.End, this.Due, this.POnTime)
+		} else {
+			warn("late: %s end %s due %s\n", this.Name, this.End, this.Due)
+		}
+		this.Late = true
 		this.Expected.Mirr = math.NaN()
 	}
 
+	if this.model != nil && this.model.ends != nil {
+		this.model.ends[this.Name] = append(this.model.ends[this.Name], this)
+	}
+
 	for _, hedge := range this.Hyperedges {
 		for _, child := range hedge.Children {
+			child.Reach = this.Reach * hedge.Prob
 			child.Forward(this, now, warn)
 		}
 	}
@@ -260,6 +537,16 @@ func (this *Ast) Backward(warn Warn) {
 				this.Expected.Duration += time.Duration(float64(child.Expected.Duration) * hedge.Prob)
 				this.Expected.Npv += child.Expected.Npv * hedge.Prob
 				this.Expected.Mirr += child.Expected.Mirr * hedge.Prob
+				this.Expected.Attrs = addAttrs(this.Expected.Attrs, child.Expected.Attrs, hedge.Prob)
+				this.Expected.Score += child.Expected.Score * hedge.Prob
+				this.Expected.MinBalance += child.Expected.MinBalance * hedge.Prob
+			}
+			// the children of a joint path each carry the path so
+			// far, which only happens once
+			if extra := float64(len(hedge.Children)-1) * hedge.Prob; extra > 0 {
+				this.Expected.Cash -= this.Path.Cash * extra
+				this.Expected.Npv -= this.Path.Npv * extra
+				this.Expected.Attrs = addAttrs(this.Expected.Attrs, this.Path.Attrs, -extra)
 			}
 		}
 	} else {
@@ -268,7 +555,12 @@ func (this *Ast) Backward(warn Warn) {
 		this.Expected.Duration = this.Path.Duration
 		this.Expected.Npv = this.Path.Npv
 		this.Expected.Mirr = this.Path.Mirr
+		this.Expected.Attrs = copyAttrs(this.Path.Attrs)
+		this.Expected.Score = this.Path.Score
+		this.Expected.MinBalance = this.Path.MinBalance
 	}
+	this.rollUpDist()
+	this.expect()
 }
 
 func form(n float64) string {
@@ -284,6 +576,10 @@ func days(d time.Duration) string {
 // (parent), and adds a graphviz edge from a to each of the children
 // of a.
 func (a *Ast) Dot(graph *cgraph.Graph, loMirr, hiMirr float64, warn Warn) (gvparent *cgraph.Node, err error) {
+	return a.dot(graph, loMirr, hiMirr, warn, Options{})
+}
+
+func (a *Ast) dot(graph *cgraph.Graph, loMirr, hiMirr float64, warn Warn, opts Options) (gvparent *cgraph.Node, err error) {
 	defer Return(&err)
 
 	count := countNodesPrefixed(graph, a.Name)
@@ -325,8 +621,20 @@ func (a *Ast) Dot(graph *cgraph.Graph, loMirr, hiMirr float64, warn Warn) (gvpar
 	}
 
 	dates := Spf("%s - %s", a.Start.Format("2006-01-02"), a.End.Format("2006-01-02"))
+	if a.Idle > 0 {
+		dates = Spf("%s \\n idle: %s", dates, days(a.Idle))
+	}
+	if a.Float >= criticalEps {
+		dates = Spf("%s \\n float: %s", dates, days(a.Float))
+	}
+	if len(a.src.Set) > 0 {
+		dates = Spf("%s \\n set: %s", dates, a.setLabel())
+	}
 	if !a.Due.IsZero() {
 		dates = Spf("%s \\n due: %s", dates, a.Due.Format("2006-01-02"))
+		if a.Path.Variance > 0 {
+			dates = Spf("%s \\n p(on time): %.2f", dates, a.POnTime)
+		}
 		if a.End.After(a.Due) {
 			color := Spf("%.3f 1.0 1.0", hue)
 			gvparent.SetFontColor(color)
@@ -384,6 +692,36 @@ func (a *Ast) Dot(graph *cgraph.Graph, loMirr, hiMirr float64, warn Warn) (gvpar
 		futureFields = append(futureFields, Spf("%.1f%%", e.Mirr))
 	}
 
+	for _, attr := range attrNames(n, p, e) {
+		headers = append(headers, attr)
+		nodeFields = append(nodeFields, form(n.Attrs[attr]))
+		pastFields = append(pastFields, form(p.Attrs[attr]))
+		futureFields = append(futureFields, form(e.Attrs[attr]))
+	}
+	if opts.ShowRisk {
+		r := a.Risk
+		headers = append(headers, "sd npv", "p(loss)", "p(late)", Spf("VaR %.0f%%", r.Level*100), "CVaR")
+		nodeFields = append(nodeFields, "", "", "", "", "")
+		pastFields = append(pastFields, "", "", "", "", "")
+		futureFields = append(futureFields, form(r.StdevNpv), Spf("%.2f", r.PLoss), Spf("%.2f", r.PLate), form(r.VaR), form(r.CVaR))
+	}
+	if a.budgeted() {
+		headers = append(headers, "min balance", "p(broke)")
+		nodeFields = append(nodeFields, "", "")
+		pastFields = append(pastFields, form(p.MinBalance), "")
+		futureFields = append(futureFields, form(e.MinBalance), Spf("%.2f", a.Risk.PBroke))
+		if a.brokeHere {
+			gvparent.SetColor("red")
+			gvparent.SetPenWidth(3)
+		}
+	}
+	if a.model != nil && len(a.model.criteria) > 0 {
+		headers = append(headers, "score")
+		nodeFields = append(nodeFields, Spf("%.2f", n.Score))
+		pastFields = append(pastFields, Spf("%.2f", p.Score))
+		futureFields = append(futureFields, Spf("%.2f", e.Score))
+	}
+
 	// Create label parts.
 	headerRow := strings.Join(headers, "|")
 	nodeRow := Spf("node     | %s", strings.Join(nodeFields, " | "))
@@ -436,7 +774,7 @@ func (a *Ast) Dot(graph *cgraph.Graph, loMirr, hiMirr float64, warn Warn) (gvpar
 		}
 		// create edges from parent to children
 		for _, child := range hedge.Children {
-			gvchild, err := child.Dot(graph, loMirr, hiMirr, warn)
+			gvchild, err := child.dot(graph, loMirr, hiMirr, warn, opts)
 			Ck(err)
 			gvedge, err := graph.CreateEdge("", parent, gvchild)
 			Ck(err)
@@ -485,10 +823,59 @@ func getMirrs(as []*Ast) (lo, hi float64) {
 	return
 }
 
+// Options change how RecalcWith computes the trees and how ToDotWith
+// draws them.  The zero value is the default.
+type Options struct {
+	// RiskLevel is the confidence level of VaR and CVaR; 0 means
+	// DefaultRiskLevel.
+	RiskLevel float64
+	// ShowRisk adds the risk metrics to the DOT labels.
+	ShowRisk bool
+	// AverageMirr makes a node's expected MIRR the probability-weighted
+	// average of its children's, as older versions did, instead of the
+	// MIRR of the expected cash flows.  The average isn't the MIRR of
+	// anything, and one leaf with an infinite MIRR (one that never
+	// spends money) makes it infinite.
+	AverageMirr bool
+	// Leveling delays nodes to fit the resource capacity.
+	Leveling bool
+}
+
+// Recalc computes the trees with the default Options.
 func Recalc(roots []*Ast, now time.Time, warn Warn) {
+	RecalcWith(roots, now, warn, Options{})
+}
 
-	// sum up Cash and Duration
+// RecalcWith computes the path, expected and critical path stats of
+// the trees.  With opts.Leveling, nodes are delayed to fit the
+// resource capacity first.  Overallocated resources are reported with
+// warn.
+func RecalcWith(roots []*Ast, now time.Time, warn Warn, opts Options) {
+	// drop the delays of an earlier leveling pass
 	for _, root := range roots {
+		root.Walk(func(node *Ast) { node.LevelStart = time.Time{} })
+	}
+	if opts.Leveling {
+		recalc(roots, now, func(args ...interface{}) {}, opts)
+		level(roots, now, warn, opts)
+	}
+	recalc(roots, now, warn, opts)
+	for _, o := range Overallocations(roots) {
+		warn("overallocated: %s\n", o)
+	}
+}
+
+func recalc(roots []*Ast, now time.Time, warn Warn, opts Options) {
+
+	// sum up Cash and Duration, doing the trees with prereqs
+	// after the trees they wait for
+	for _, root := range roots {
+		if root.model != nil {
+			root.model.ends = make(map[string][]*Ast)
+		}
+	}
+	for _, root := range prereqOrder(roots, warn) {
+		root.opts = opts
 		root.Forward(nil, now, warn)
 	}
 
@@ -497,13 +884,17 @@ func Recalc(roots []*Ast, now time.Time, warn Warn) {
 		root.Backward(warn)
 	}
 
-	// set critical path field
-	for _, root := range roots {
-		root.SetCriticalPath()
-	}
+	// set float and critical path fields
+	criticalPath(roots)
 }
 
+// ToDot draws the trees with the default Options.
 func ToDot(roots []*Ast, warn Warn, tb bool) (buf []byte) {
+	return ToDotWith(roots, warn, tb, Options{})
+}
+
+// ToDotWith draws the trees, after Recalc, as a graphviz DOT graph.
+func ToDotWith(roots []*Ast, warn Warn, tb bool, opts Options) (buf []byte) {
 	loMirr, hiMirr := getMirrs(roots)
 
 	g := graphviz.New()
@@ -526,7 +917,7 @@ func ToDot(roots []*Ast, warn Warn, tb bool) (buf []byte) {
 		return roots[i].Name < roots[j].Name
 	})
 	for _, root := range roots {
-		root.Dot(graph, loMirr, hiMirr, warn)
+		root.dot(graph, loMirr, hiMirr, warn, opts)
 	}
 
 	var dotbuf bytes.Buffer
@@ -576,7 +967,7 @@ func LsExamples(fs embed.FS) (out string) {
 // countNodesPrefixed returns the number of nodes with the given name.
 // This is used to create unique node names in the graphviz output.
 func countNodesPrefixed(graph *cgraph.Graph, name string) (n int) {
-	re := regexp.MustCompile(Spf("^%s_[0-9]+$", name))
+	re := regexp.MustCompile(Spf("^%s_[0-9]+$", regexp.QuoteMeta(name)))
 	for _, node := range allNodes(graph) {
 		if re.MatchString(node.Name()) {
 			n++
@@ -594,29 +985,3 @@ func allNodes(graph *cgraph.Graph) (nodes []*cgraph.Node) {
 	}
 	return
 }
-
-// SetCriticalPath sets the Critical field of the Ast struct to true
-// if the node is on the critical path.  We determine the critical path
-// by looking at the expected days of each of the children of the given
-// node.
-func (this *Ast) SetCriticalPath() {
-	maxDur := time.Duration(0)
-	for _, hedge := range this.Hyperedges {
-		// recurse
-		for _, child := range hedge.Children {
-			child.SetCriticalPath()
-		}
-		for _, child := range hedge.Children {
-			if child.Expected.Duration > maxDur {
-				maxDur = child.Expected.Duration
-			}
-		}
-	}
-	for _, hedge := range this.Hyperedges {
-		for _, child := range hedge.Children {
-			if child.Expected.Duration >= maxDur {
-				child.Critical = true
-			}
-		}
-	}
-}
@@ -0,0 +1,110 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// A repeated node with `hazard:` can fail at the end of each period,
+// which stops its stream of cash.  The hazard is the probability of
+// failing in a period, and can depend on the period number through
+// the node-local var `period` (1, 2, ...):
+//
+//	license:
+//	  cash: 100k
+//	  days: 365
+//	  repeat: 10
+//	  hazard: 0.02 * period
+//	  onFail: churned
+//	  paths:
+//	    renewal: 1
+//
+// The node is expanded to a chain of single-period steps, `license`,
+// `license/2` ... `license/10`, each of which either survives to the
+// next step or fails to the `onFail:` node (by default a terminal
+// `license/failed` node).  A node that survives its last period goes
+// on to its own `paths:` by way of `license/survived`; if it has no
+// paths, the last period carries no hazard.  Like `for:` bounds, the
+// node's `repeat:` can't refer to other nodes, since the chain is
+// built before references are resolved.
+
+// expandHazard replaces the named node with a chain of steps.
+func (m *Model) expandHazard(name string) (err error) {
+	node := m.nodes[name]
+	if len(node.Uncertainties) > 0 {
+		return fmt.Errorf("%s: hazard: can't be combined with uncertainties", name)
+	}
+	vars, err := resolveVars("vars", node.Vars, m.vars)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	repeat := 1.0
+	if node.Repeat != "" {
+		err = m.noRefs(node.Repeat)
+		if err != nil {
+			return fmt.Errorf("%s: hazard: repeat: %v", name, err)
+		}
+		repeat, err = evalFloat(node.Repeat, vars)
+		if err != nil {
+			return fmt.Errorf("%s: hazard: repeat: %v", name, err)
+		}
+	}
+	n := int(math.Max(1, repeat))
+	if n > maxSteps {
+		return fmt.Errorf("%s: hazard: repeat too large: %d", name, n)
+	}
+
+	fail := node.OnFail
+	if fail == "" {
+		fail = name + "/failed"
+		if _, ok := m.nodes[fail]; ok {
+			return fmt.Errorf("%s: hazard: %s collides with an existing node", name, fail)
+		}
+		m.nodes[fail] = Node{Desc: Spf("%s failed", name)}
+	} else if _, ok := m.nodes[fail]; !ok {
+		return fmt.Errorf("%s: onFail: no such node: %s", name, fail)
+	}
+	stepName := func(k int) string {
+		if k == 1 {
+			return name
+		}
+		return Spf("%s/%d", name, k)
+	}
+	cont := node.Paths
+	survive := Spf("1 - (%s)", node.Hazard)
+	hazard := Spf("(%s)", node.Hazard)
+	node.Hazard = ""
+	node.OnFail = ""
+	node.Repeat = "1"
+	for k := 1; k <= n; k++ {
+		step := node
+		step.Vars = map[string]string{"period": Spf("%d", k)}
+		for v, expr := range node.Vars {
+			if v != "period" {
+				step.Vars[v] = expr
+			}
+		}
+		switch {
+		case k < n:
+			step.Paths = Paths{stepName(k + 1): survive, fail: hazard}
+		case len(cont) > 0:
+			done := name + "/survived"
+			if _, ok := m.nodes[done]; ok {
+				return fmt.Errorf("%s: hazard: %s collides with an existing node", name, done)
+			}
+			m.nodes[done] = Node{Desc: Spf("%s survived", name), Paths: cont}
+			step.Paths = Paths{done: survive, fail: hazard}
+		default:
+			step.Paths = nil
+		}
+		if k > 1 {
+			if _, ok := m.nodes[stepName(k)]; ok {
+				return fmt.Errorf("%s: hazard: %s collides with an existing node", name, stepName(k))
+			}
+		}
+		m.nodes[stepName(k)] = step
+	}
+	return
+}
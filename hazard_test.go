@@ -0,0 +1,58 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestHazard(t *testing.T) {
+	buf := []byte(`
+license:
+  cash: 100k
+  days: 365
+  repeat: 3
+  hazard: 0.1 * period
+  paths:
+    renewal: 1
+renewal:
+  cash: 50k
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	node := roots[0]
+	survive := []float64{.9, .8, .7}
+	for k, name := range []string{"license", "license/2", "license/3"} {
+		Tassert(t, node.Name == name, "step %d: %s", k+1, node.Name)
+		Tassert(t, node.Repeat == 1, "%s repeat %d", name, node.Repeat)
+		Tassert(t, len(node.Hyperedges) == 2, "%s hyperedges %d", name, len(node.Hyperedges))
+		fail, next := node.Hyperedges[0], node.Hyperedges[1]
+		if next.Path == "license/failed" {
+			fail, next = next, fail
+		}
+		Tassert(t, fail.Children[0].Name == "license/failed", "%s fails to %s", name, fail.Path)
+		Tassert(t, math.Abs(next.Prob-survive[k]) < 1e-9, "%s survives with %v", name, next.Prob)
+		node = next.Children[0]
+	}
+	Tassert(t, node.Name == "license/survived", "chain ends at %s", node.Name)
+	Tassert(t, node.Hyperedges[0].Children[0].Name == "renewal", "continues to %s", node.Hyperedges[0].Path)
+	want := 100e3 + .9*(100e3+.8*(100e3+.7*50e3))
+	Tassert(t, math.Abs(roots[0].Expected.Cash-want) < 1e-6, "expected cash %v want %v", roots[0].Expected.Cash, want)
+}
+
+func TestHazardErrors(t *testing.T) {
+	cases := map[string]string{
+		"a:\n  repeat: 2\n  hazard: .1\n  onFail: nope\n": "no such node: nope",
+		"a:\n  repeat: b.repeat\n  hazard: .1\nb:\n":      "hazard: repeat: can't refer to b.repeat",
+	}
+	for yml, want := range cases {
+		_, err := FromYAML([]byte(yml))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: want %q, got %v", yml, want, err)
+	}
+}
@@ -0,0 +1,328 @@
+package tree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"gopkg.in/yaml.v2"
+)
+
+// A model can pull in nodes, templates, submodels, params, state,
+// uncertainties, tests, criteria, capacity, a budget and a calendar
+// from other files with a model-level `include:` list.  Paths are
+// relative to the including file.  An entry with `as:` puts the
+// included nodes, templates and submodels in a namespace, so
+// `forecast` in sales.yaml becomes `sales/forecast`:
+//
+//	include:
+//	  - common.yaml
+//	  - file: depts/sales.yaml
+//	    as: sales
+//	plan:
+//	  paths:
+//	    sales/forecast: 1
+//
+// Names an included file doesn't define itself are left alone, so its
+// paths can lead back into the including model.  Defining the same
+// name in two files is an error.
+type Include struct {
+	File string
+	As   string `yaml:",omitempty"`
+}
+
+// UnmarshalYAML accepts either a bare filename or a {file, as} map.
+func (inc *Include) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	err := unmarshal(&inc.File)
+	if err == nil {
+		return nil
+	}
+	type plain Include
+	return unmarshal((*plain)(inc))
+}
+
+// ReadFunc reads a model file, e.g. ioutil.ReadFile or an embed.FS's
+// ReadFile.
+type ReadFunc func(fn string) ([]byte, error)
+
+// FromFile reads the named model file, along with any files it
+// includes, and converts it to Ast trees.
+func FromFile(fn string) (roots []*Ast, err error) {
+	defer Return(&err)
+	model, err := LoadModel(fn, ioutil.ReadFile)
+	Ck(err)
+	roots = model.ToAst()
+	return
+}
+
+// LoadModel reads the named model file with read, and merges in the
+// files it includes.
+func LoadModel(fn string, read ReadFunc) (model *Model, err error) {
+	return loadModel(fn, read, nil)
+}
+
+func loadModel(fn string, read ReadFunc, stack []string) (model *Model, err error) {
+	fn = path.Clean(fn)
+	for _, seen := range stack {
+		if seen == fn {
+			return nil, fmt.Errorf("include: cycle: %s -> %s", strings.Join(stack, " -> "), fn)
+		}
+	}
+	buf, err := read(fn)
+	if err != nil {
+		if len(stack) > 0 {
+			err = fmt.Errorf("%s: include: %v", stack[len(stack)-1], err)
+		}
+		return
+	}
+	model, err = parseModel(buf, fn)
+	if err != nil {
+		return
+	}
+	err = model.include(path.Dir(fn), read, append(stack, fn))
+	return
+}
+
+// parseModel unmarshals buf, recording fn as the source of each
+// definition.
+func parseModel(buf []byte, fn string) (model *Model, err error) {
+	model = &Model{}
+	err = yaml.Unmarshal(buf, model)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	model.sources = make(map[string]string)
+	model.eachDef(func(kind, name string) { model.sources[kind+" "+name] = fn })
+	return
+}
+
+// include merges in the model's included files, reading them
+// relative to dir.  The calendar's holiday file is read the same way.
+// With no dir, only absolute paths can be read.
+func (m *Model) include(dir string, read ReadFunc, stack []string) (err error) {
+	if m.Calendar != nil {
+		m.Calendar.dir, m.Calendar.read = dir, read
+	}
+	for _, inc := range m.Include {
+		if inc.File == "" {
+			return fmt.Errorf("%s: include: missing file", stack[len(stack)-1])
+		}
+		fn := inc.File
+		if !path.IsAbs(fn) {
+			if dir == "" {
+				return fmt.Errorf("%s: include: relative path %s needs a model file to be relative to", stack[len(stack)-1], fn)
+			}
+			fn = path.Join(dir, fn)
+		}
+		var sub *Model
+		sub, err = loadModel(fn, read, stack)
+		if err != nil {
+			return
+		}
+		if inc.As != "" {
+			if !nsRe.MatchString(inc.As) {
+				return fmt.Errorf("%s: include: invalid namespace: %q", fn, inc.As)
+			}
+			sub.namespace(inc.As)
+		}
+		err = m.merge(sub)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+var nsRe = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+
+// eachDef calls f for each name the model defines.
+func (m *Model) eachDef(f func(kind, name string)) {
+	for name := range m.Nodes {
+		f("node", name)
+	}
+	for name := range m.Templates {
+		f("template", name)
+	}
+	for name := range m.Submodels {
+		f("submodel", name)
+	}
+	for name := range m.Params {
+		f("param", name)
+	}
+	for name := range m.State {
+		f("state", name)
+	}
+	for _, u := range m.Uncertainties {
+		f("uncertainty", u.Name)
+	}
+	for name := range m.Tests {
+		f("test", name)
+	}
+	for name := range m.Criteria {
+		f("criterion", name)
+	}
+	for name := range m.Capacity {
+		f("capacity", name)
+	}
+	if m.Calendar != nil {
+		f("calendar", "")
+	}
+	if m.Budget != nil {
+		f("budget", "")
+	}
+}
+
+// namespace prefixes the names of the model's nodes, templates and
+// submodels with ns, and the references to them.
+func (m *Model) namespace(ns string) {
+	rename := make(map[string]string)
+	for name := range m.Nodes {
+		rename[name] = ns + "/" + name
+	}
+	for name := range m.Templates {
+		rename[name] = ns + "/" + name
+	}
+	subRename := make(map[string]string)
+	for name := range m.Submodels {
+		subRename[name] = ns + "/" + name
+	}
+	renameAll := func(nodes Nodes, rename map[string]string, prefix bool) Nodes {
+		out := make(Nodes, len(nodes))
+		for name, node := range nodes {
+			node = renameNode(node, rename)
+			if use, ok := renameUse(node.Use, subRename); ok {
+				node.Use = use
+			}
+			if prefix {
+				name = rename[name]
+			}
+			out[name] = node
+		}
+		return out
+	}
+	m.Nodes = renameAll(m.Nodes, rename, true)
+	m.Templates = renameAll(m.Templates, rename, true)
+	submodels := make(map[string]Submodel, len(m.Submodels))
+	for name, sub := range m.Submodels {
+		// a submodel's own node names shadow the outer ones
+		inner := make(map[string]string)
+		for k, v := range rename {
+			if _, ok := sub.Nodes[k]; !ok {
+				inner[k] = v
+			}
+		}
+		sub.Nodes = renameAll(sub.Nodes, inner, false)
+		submodels[subRename[name]] = sub
+	}
+	m.Submodels = submodels
+	sources := make(map[string]string, len(m.sources))
+	for key, fn := range m.sources {
+		kind := strings.SplitN(key, " ", 2)
+		switch kind[0] {
+		case "node", "template", "submodel":
+			key = kind[0] + " " + ns + "/" + kind[1]
+		}
+		sources[key] = fn
+	}
+	m.sources = sources
+}
+
+// renameUse maps the submodel name in a `use:` value through rename.
+func renameUse(use string, rename map[string]string) (out string, ok bool) {
+	if use == "" {
+		return
+	}
+	name, _, err := parseUse(use)
+	if err != nil {
+		return
+	}
+	to, ok := rename[name]
+	if !ok {
+		return
+	}
+	i := strings.Index(use, name)
+	return use[:i] + to + use[i+len(name):], true
+}
+
+// merge adds the definitions from sub, which must not already be
+// defined.
+func (m *Model) merge(sub *Model) (err error) {
+	var dups []string
+	sub.eachDef(func(kind, name string) {
+		key := kind + " " + name
+		if fn, ok := m.sources[key]; ok {
+			what := kind
+			if name != "" {
+				what = Spf("%s %s", kind, name)
+			}
+			dups = append(dups, Spf("duplicate %s: defined in %s and %s", what, fn, sub.sources[key]))
+		}
+	})
+	if len(dups) > 0 {
+		sort.Strings(dups)
+		return fmt.Errorf("include: %s", strings.Join(dups, "; "))
+	}
+	if m.Nodes == nil {
+		m.Nodes = make(Nodes)
+	}
+	for name, node := range sub.Nodes {
+		m.Nodes[name] = node
+	}
+	if len(sub.Templates) > 0 && m.Templates == nil {
+		m.Templates = make(Nodes)
+	}
+	for name, node := range sub.Templates {
+		m.Templates[name] = node
+	}
+	if len(sub.Submodels) > 0 && m.Submodels == nil {
+		m.Submodels = make(map[string]Submodel)
+	}
+	for name, s := range sub.Submodels {
+		m.Submodels[name] = s
+	}
+	if len(sub.Params) > 0 && m.Params == nil {
+		m.Params = make(map[string]string)
+	}
+	for name, expr := range sub.Params {
+		m.Params[name] = expr
+	}
+	if len(sub.State) > 0 && m.State == nil {
+		m.State = make(map[string]string)
+	}
+	for name, expr := range sub.State {
+		m.State[name] = expr
+	}
+	m.Uncertainties = append(m.Uncertainties, sub.Uncertainties...)
+	if len(sub.Tests) > 0 && m.Tests == nil {
+		m.Tests = make(map[string]Test)
+	}
+	for name, test := range sub.Tests {
+		m.Tests[name] = test
+	}
+	if len(sub.Criteria) > 0 && m.Criteria == nil {
+		m.Criteria = make(map[string]string)
+	}
+	for name, expr := range sub.Criteria {
+		m.Criteria[name] = expr
+	}
+	if len(sub.Capacity) > 0 && m.Capacity == nil {
+		m.Capacity = make(map[string]string)
+	}
+	for name, expr := range sub.Capacity {
+		m.Capacity[name] = expr
+	}
+	if sub.Calendar != nil {
+		m.Calendar = sub.Calendar
+	}
+	if sub.Budget != nil {
+		m.Budget = sub.Budget
+	}
+	for key, fn := range sub.sources {
+		m.sources[key] = fn
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package tree
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func writeFiles(t *testing.T, files map[string]string) (dir string) {
+	dir = t.TempDir()
+	for fn, body := range files {
+		path := filepath.Join(dir, fn)
+		err := ioutil.WriteFile(path, []byte(body), 0644)
+		Tassert(t, err == nil, "%v", err)
+	}
+	return
+}
+
+func TestInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.yaml": `
+include:
+  - common.yaml
+  - file: dept.yaml
+    as: sales
+  - file: dept.yaml
+    as: ops
+plan:
+  paths:
+    sales/forecast,ops/forecast: 1
+`,
+		"common.yaml": `
+params:
+  growth: 1.1
+templates:
+  annual:
+    days: 365
+`,
+		"dept.yaml": `
+templates:
+  quarter:
+    days: 90
+forecast:
+  extends: quarter
+  cash: 100k * growth
+  paths:
+    review: 1
+review:
+  cash: -forecast.cash / 10
+`,
+	})
+	roots, err := FromFile(filepath.Join(dir, "main.yaml"))
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, len(roots) == 1, "roots %d", len(roots))
+	hedge := roots[0].Hyperedges[0]
+	Tassert(t, hedge.Path == "ops/forecast,sales/forecast" || hedge.Path == "sales/forecast,ops/forecast", "path %s", hedge.Path)
+	for _, child := range hedge.Children {
+		Tassert(t, strings.HasSuffix(child.Name, "/forecast"), "child %s", child.Name)
+		Tassert(t, child.Node.Cash == 110000, "%s cash %v", child.Name, child.Node.Cash)
+		Tassert(t, child.Node.Duration.Hours() == 90*24, "%s days %v", child.Name, child.Node.Duration)
+		review := child.Hyperedges[0].Children[0]
+		want := strings.TrimSuffix(child.Name, "forecast") + "review"
+		Tassert(t, review.Name == want, "review %s, want %s", review.Name, want)
+		Tassert(t, review.Node.Cash == -11000, "review cash %v", review.Node.Cash)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"dup.yaml":   "include: [a.yaml, b.yaml]\n",
+		"a.yaml":     "params:\n  x: 1\nfoo:\n  cash: 1\n",
+		"b.yaml":     "params:\n  x: 2\nfoo:\n  cash: 2\n",
+		"cycle.yaml": "include: [loop.yaml]\n",
+		"loop.yaml":  "include: [cycle.yaml]\n",
+		"miss.yaml":  "include: [nope.yaml]\n",
+	})
+	cases := map[string][]string{
+		"dup.yaml":   {"duplicate node foo: defined in", "a.yaml and", "b.yaml", "duplicate param x"},
+		"cycle.yaml": {"include: cycle:", "loop.yaml ->"},
+		"miss.yaml":  {"miss.yaml: include:", "nope.yaml"},
+	}
+	for fn, wants := range cases {
+		_, err := FromFile(filepath.Join(dir, fn))
+		Tassert(t, err != nil, "%s: expected error", fn)
+		for _, want := range wants {
+			Tassert(t, strings.Contains(err.Error(), want), "%s: want %q, got %v", fn, want, err)
+		}
+	}
+}
+
+func TestIncludeFromYAML(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"common.yaml":  "params:\n  growth: 1.1\n",
+		"holidays.txt": "2023-01-05\n",
+	})
+	buf := []byte("include: [common.yaml]\nfoo:\n  cash: 100 * growth\n")
+
+	// there is no model file to be relative to
+	_, err := FromYAML(buf)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "relative path common.yaml"), "got %v", err)
+	_, err = FromYAML([]byte("calendar:\n  holidayFile: holidays.txt\nfoo:\n  days: 1\n"))
+	Tassert(t, err != nil && strings.Contains(err.Error(), "relative holidayFile"), "got %v", err)
+
+	roots, err := FromYAMLIn(buf, dir)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, roots[0].Node.Cash == 110, "cash %v", roots[0].Node.Cash)
+	abs := Spf("include: [%s]\nfoo:\n  cash: 100 * growth\n", filepath.Join(dir, "common.yaml"))
+	roots, err = FromYAML([]byte(abs))
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, roots[0].Node.Cash == 110, "cash %v", roots[0].Node.Cash)
+}
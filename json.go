@@ -0,0 +1,122 @@
+package tree
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// jsonStats is Stats in machine-readable form, with durations in days
+// and invalid numbers (such as the MIRR of a late path) as null.
+type jsonStats struct {
+	Days       float64            `json:"days"`
+	Cash       float64            `json:"cash"`
+	Npv        *float64           `json:"npv"`
+	Mirr       *float64           `json:"mirr"`
+	Attrs      map[string]float64 `json:"attrs,omitempty"`
+	Score      float64            `json:"score,omitempty"`
+	Variance   float64            `json:"variance,omitempty"`   // days squared
+	MinBalance *float64           `json:"minBalance,omitempty"` // with a budget
+}
+
+type jsonRisk struct {
+	Level    float64  `json:"level"`
+	StdevNpv *float64 `json:"stdevNpv"`
+	PLoss    float64  `json:"pLoss"`
+	PLate    float64  `json:"pLate"`
+	PBroke   float64  `json:"pBroke,omitempty"`
+	VaR      *float64 `json:"var"`
+	CVaR     *float64 `json:"cvar"`
+}
+
+type jsonNode struct {
+	Name     string     `json:"name"`
+	Desc     string     `json:"desc,omitempty"`
+	Prob     float64    `json:"prob"`
+	Start    time.Time  `json:"start"`
+	End      time.Time  `json:"end"`
+	Due      *time.Time `json:"due,omitempty"`
+	POnTime  *float64   `json:"pOnTime,omitempty"`
+	Late     bool       `json:"late,omitempty"`
+	Broke    bool       `json:"broke,omitempty"`
+	Float    float64    `json:"floatDays"`
+	Critical bool       `json:"critical,omitempty"`
+	Node     jsonStats  `json:"node"`
+	Path     jsonStats  `json:"path"`
+	Expected jsonStats  `json:"expected"`
+	Risk     jsonRisk   `json:"risk"`
+	Children []jsonNode `json:"children,omitempty"`
+}
+
+// ToJSON returns the trees, after Recalc, as JSON: each node with its
+// stats, risk metrics and children, and the probability of the path
+// into it.
+func ToJSON(roots []*Ast) (buf []byte, err error) {
+	var nodes []jsonNode
+	for _, root := range roots {
+		nodes = append(nodes, root.toJSON(1))
+	}
+	return json.MarshalIndent(nodes, "", "  ")
+}
+
+func (a *Ast) toJSON(prob float64) (node jsonNode) {
+	node = jsonNode{
+		Name:     a.Name,
+		Desc:     a.Desc,
+		Prob:     prob,
+		Start:    a.Start,
+		End:      a.End,
+		Late:     a.Late,
+		Broke:    a.Broke,
+		Float:    float64(a.Float) / float64(24*time.Hour),
+		Critical: a.Critical,
+		Node:     a.Node.toJSON(),
+		Path:     a.Path.toJSON(),
+		Expected: a.Expected.toJSON(),
+		Risk: jsonRisk{
+			Level:    a.Risk.Level,
+			StdevNpv: finite(a.Risk.StdevNpv),
+			PLoss:    a.Risk.PLoss,
+			PLate:    a.Risk.PLate,
+			PBroke:   a.Risk.PBroke,
+			VaR:      finite(a.Risk.VaR),
+			CVaR:     finite(a.Risk.CVaR),
+		},
+	}
+	if a.budgeted() {
+		path, expected := a.Path.MinBalance, a.Expected.MinBalance
+		node.Path.MinBalance = &path
+		node.Expected.MinBalance = &expected
+	}
+	if !a.Due.IsZero() {
+		due := a.Due
+		node.Due = &due
+		node.POnTime = &a.POnTime
+	}
+	for _, hedge := range a.Hyperedges {
+		for _, child := range hedge.Children {
+			node.Children = append(node.Children, child.toJSON(hedge.Prob))
+		}
+	}
+	return
+}
+
+func (s Stats) toJSON() jsonStats {
+	return jsonStats{
+		Days:     float64(s.Duration) / float64(24*time.Hour),
+		Cash:     s.Cash,
+		Npv:      finite(s.Npv),
+		Mirr:     finite(s.Mirr),
+		Attrs:    s.Attrs,
+		Score:    s.Score,
+		Variance: s.Variance,
+	}
+}
+
+// finite returns a pointer to f, or nil if f is NaN or infinite.
+func finite(f float64) *float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,208 @@
+package tree
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/rickb777/date/period"
+	"github.com/soudy/mathcat"
+	. "github.com/stevegt/goadapt"
+	"github.com/stevegt/godecide/fin"
+)
+
+// Literals with units are rewritten into plain mathcat expressions
+// before evaluation, so they can be mixed with ordinary arithmetic,
+// e.g. `cash: -1.2M + 50k` or `days: 2w + 3d`.
+
+var (
+	// thousands separators, e.g. 1,000,000
+	thousandsRe = regexp.MustCompile(`(^|[^\w.])(\d{1,3}(?:,\d{3})+)`)
+	// amount suffixes, e.g. 50k, 1.2M, 3bn
+	amountRe = regexp.MustCompile(`(^|[^\w.])(\d+(?:\.\d+)?)\s*(k|K|M|mm|B|bn)\b`)
+	// currency symbol in front of a number
+	currencyRe = regexp.MustCompile(`\$\s*(\d)`)
+	// ISO-8601 periods, e.g. P1Y2M
+	isoPeriodRe = regexp.MustCompile(`(^|[^\w.])(P(?:[0-9.]+[YMWD])+)\b`)
+	// duration units, e.g. 2w, 3 months
+	durationRe = regexp.MustCompile(`(^|[^\w.])(\d+(?:\.\d+)?)\s*(days?|d|weeks?|wks?|w|months?|mos?|m|years?|yrs?|y)\b`)
+)
+
+var amountSuffixes = map[string]string{
+	"k":  "1000",
+	"K":  "1000",
+	"M":  "1000000",
+	"mm": "1000000",
+	"B":  "1000000000",
+	"bn": "1000000000",
+}
+
+// unitOf normalizes a duration unit name to one of d, w, m or y.
+func unitOf(name string) (unit byte, err error) {
+	switch strings.ToLower(name) {
+	case "d", "day", "days":
+		unit = 'd'
+	case "w", "wk", "wks", "week", "weeks":
+		unit = 'w'
+	case "m", "mo", "mos", "month", "months":
+		unit = 'm'
+	case "y", "yr", "yrs", "year", "years":
+		unit = 'y'
+	default:
+		err = fmt.Errorf("invalid unit: %q", name)
+	}
+	return
+}
+
+// daysPerUnit returns the (average) number of days in a unit.
+func daysPerUnit(unit byte) string {
+	switch unit {
+	case 'w':
+		return "7"
+	case 'm':
+		return fmt.Sprintf("%v", fin.DaysPerYear/12)
+	case 'y':
+		return fmt.Sprintf("%v", fin.DaysPerYear)
+	}
+	return "1"
+}
+
+// periodDays returns the number of days in an ISO-8601 period, using
+// average month and year lengths.
+func periodDays(p period.Period) float64 {
+	years := float64(p.YearsFloat())
+	months := float64(p.MonthsFloat())
+	days := float64(p.DaysFloat())
+	return years*fin.DaysPerYear + months*fin.DaysPerYear/12 + days
+}
+
+// expandAmount rewrites amount literals such as `50k`, `1.2M`,
+// `$1,000,000` into plain numbers.  Thousands separators are only
+// recognized outside of function calls, where a comma separates
+// arguments.
+func expandAmount(expr string) string {
+	expr = currencyRe.ReplaceAllString(expr, "$1")
+	inCall := callArgs(expr)
+	var buf strings.Builder
+	last := 0
+	for _, m := range thousandsRe.FindAllStringSubmatchIndex(expr, -1) {
+		if inCall[m[4]] {
+			continue
+		}
+		buf.WriteString(expr[last:m[4]])
+		buf.WriteString(strings.Replace(expr[m[4]:m[5]], ",", "", -1))
+		last = m[5]
+	}
+	buf.WriteString(expr[last:])
+	expr = buf.String()
+	expr = amountRe.ReplaceAllStringFunc(expr, func(s string) string {
+		m := amountRe.FindStringSubmatch(s)
+		return Spf("%s(%s*%s)", m[1], m[2], amountSuffixes[m[3]])
+	})
+	return expr
+}
+
+// callArgs reports, for each byte of expr, whether it's inside the
+// parentheses of a function call such as `max(...)`, as opposed to
+// parentheses that only group.
+func callArgs(expr string) (in []bool) {
+	in = make([]bool, len(expr))
+	var stack []bool // is each open paren a call
+	calls := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(':
+			j := strings.TrimRight(expr[:i], " ")
+			call := len(j) > 0 && isWordByte(j[len(j)-1])
+			stack = append(stack, call)
+			if call {
+				calls++
+			}
+		case ')':
+			if len(stack) > 0 {
+				if stack[len(stack)-1] {
+					calls--
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+		in[i] = calls > 0
+	}
+	return
+}
+
+// isWordByte reports whether c can be part of a name.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// expandDays rewrites duration literals such as `2w`, `3 months` or
+// `P1Y2M` into a number of days.
+func expandDays(expr string) (out string, err error) {
+	out = isoPeriodRe.ReplaceAllStringFunc(expr, func(s string) string {
+		m := isoPeriodRe.FindStringSubmatch(s)
+		p, perr := period.Parse(m[2], false)
+		if perr != nil {
+			err = perr
+			return s
+		}
+		return Spf("%s(%v)", m[1], periodDays(p))
+	})
+	if err != nil {
+		return
+	}
+	out = durationRe.ReplaceAllStringFunc(out, func(s string) string {
+		m := durationRe.FindStringSubmatch(s)
+		unit, uerr := unitOf(m[3])
+		if uerr != nil {
+			err = uerr
+			return s
+		}
+		return Spf("%s(%s*%s)", m[1], m[2], daysPerUnit(unit))
+	})
+	return
+}
+
+// evalRat evaluates a mathcat expression with the given variables.
+func evalRat(expr string, vars Vars) (rat *big.Rat, err error) {
+	return mathcat.Exec(expr, vars)
+}
+
+// evalFloat evaluates a mathcat expression with the given variables.
+func evalFloat(expr string, vars Vars) (val float64, err error) {
+	rat, err := evalRat(expr, vars)
+	if err != nil {
+		return
+	}
+	val, _ = rat.Float64()
+	return
+}
+
+// evalAmount evaluates a `cash:` field.
+func evalAmount(expr string, vars Vars) (val float64, err error) {
+	val, err = evalFloat(expandAmount(expr), vars)
+	if err != nil {
+		err = fmt.Errorf("%q: %v", expr, err)
+	}
+	return
+}
+
+// ParseAmount evaluates an amount the way a `cash:` field is
+// evaluated, e.g. `3M` or `1,500,000`, for amounts given outside of a
+// model such as on the command line.
+func ParseAmount(s string) (val float64, err error) {
+	return evalAmount(s, nil)
+}
+
+// evalDays evaluates a `days:` field to a number of days.
+func evalDays(expr string, vars Vars) (val float64, err error) {
+	expanded, err := expandDays(expr)
+	if err == nil {
+		val, err = evalFloat(expanded, vars)
+	}
+	if err != nil {
+		err = fmt.Errorf("%q: %v", expr, err)
+	}
+	return
+}
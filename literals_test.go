@@ -0,0 +1,82 @@
+package tree
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestEvalAmount(t *testing.T) {
+	cases := map[string]float64{
+		"":               0,
+		"-5000":          -5000,
+		"50k":            50000,
+		"-1.2M":          -1200000,
+		"3bn":            3e9,
+		"1,000,000":      1e6,
+		"-$2,500.50":     -2500.5,
+		"50k * 2 + 1.5M": 1600000,
+		"max(1,2) * 1k":  2000,
+		"1,000 * (2+3)":  5000,
+		"(1,500 - 500)":  1000,
+		"0x1B":           27,
+	}
+	for expr, want := range cases {
+		got, err := evalAmount(expr, nil)
+		Tassert(t, err == nil, "%s: %v", expr, err)
+		Tassert(t, math.Abs(got-want) < 1e-6, "%s: got %v want %v", expr, got, want)
+	}
+	_, err := evalAmount("50q", nil)
+	Tassert(t, err != nil, "expected error")
+	got, err := ParseAmount("$3M")
+	Tassert(t, err == nil && got == 3e6, "ParseAmount got %v, %v", got, err)
+}
+
+func TestEvalDays(t *testing.T) {
+	cases := map[string]float64{
+		"":          0,
+		"365":       365,
+		"2w":        14,
+		"3 months":  3 * 365.2425 / 12,
+		"1 year":    365.2425,
+		"P1Y2M":     365.2425 * 14 / 12,
+		"P2W":       14,
+		"2w + 3d":   17,
+		"10 * 1wk":  70,
+		"P1D * 2.5": 2.5,
+	}
+	for expr, want := range cases {
+		got, err := evalDays(expr, nil)
+		Tassert(t, err == nil, "%s: %v", expr, err)
+		Tassert(t, math.Abs(got-want) < 1e-6, "%s: got %v want %v", expr, got, want)
+	}
+	_, err := evalDays("3 fortnights", nil)
+	Tassert(t, err != nil, "expected error")
+}
+
+func TestFractionalDays(t *testing.T) {
+	src := `
+start:
+  days: 3 months
+  paths:
+    build: 1
+build:
+  days: 1, 2, 4
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	start := roots[0]
+	build := start.Hyperedges[0].Children[0]
+	day := float64(24 * time.Hour)
+	got := float64(start.Node.Duration) / day
+	Tassert(t, math.Abs(got-3*365.2425/12) < 1e-6, "3 months got %v days", got)
+	// the PERT mean is 13/6 days
+	got = float64(build.Node.Duration) / day
+	Tassert(t, math.Abs(got-13.0/6) < 1e-6, "build got %v days", got)
+	want := now.Add(time.Duration((3*365.2425/12 + 13.0/6) * day))
+	Tassert(t, build.End.Sub(want).Abs() < time.Second, "build end %v want %v", build.End, want)
+}
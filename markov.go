@@ -0,0 +1,109 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A node with `markov:` runs a small Markov cohort model for its
+// `repeat:` cycles of `days:` each, instead of paying the same cash
+// every period.  `start:` gives the initial count (or share) in each
+// state, each state has a cash amount per member per cycle, and `to:`
+// gives the per-cycle transition probabilities, which can be
+// expressions or `rest`:
+//
+//	customers:
+//	  days: 30
+//	  repeat: 24
+//	  markov:
+//	    start: {active: 1000}
+//	    states:
+//	      active:
+//	        cash: 50
+//	        to: {active: .95, churned: rest}
+//	      churned:
+//	        to: {churned: 1}
+//
+// The cash of each cycle is the node's own `cash:` plus the expected
+// cash of the cohort at the start of the cycle, and goes on the
+// timeline as one event per cycle.
+type Markov struct {
+	Start  map[string]string
+	States map[string]MarkovState
+}
+
+// MarkovState is one state of a Markov cohort model.
+type MarkovState struct {
+	Cash string `yaml:",omitempty"`
+	To   Paths
+}
+
+// flows returns the expected cash of the cohort in each of n cycles.
+func (mk *Markov) flows(vars Vars, n int) (flows []float64, err error) {
+	var names []string
+	for name := range mk.States {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no states")
+	}
+
+	cash := make(map[string]float64)
+	to := make(map[string]map[string]float64)
+	for _, name := range names {
+		state := mk.States[name]
+		cash[name], err = evalAmount(state.Cash, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cash: %v", name, err)
+		}
+		to[name], err = state.To.Probs(vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: to: %v", name, err)
+		}
+		total := 0.0
+		for next, p := range to[name] {
+			if _, ok := mk.States[next]; !ok {
+				return nil, fmt.Errorf("%s: to: no such state: %s", name, next)
+			}
+			total += p
+		}
+		if math.Abs(total-1) > .001 {
+			return nil, fmt.Errorf("%s: to: probabilities add up to %v, not 1", name, total)
+		}
+	}
+
+	occupancy := make(map[string]float64)
+	for name, expr := range mk.Start {
+		if _, ok := mk.States[name]; !ok {
+			return nil, fmt.Errorf("start: no such state: %s", name)
+		}
+		occupancy[name], err = evalAmount(expr, vars)
+		if err != nil {
+			return nil, fmt.Errorf("start: %s: %v", name, err)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		flow := 0.0
+		next := make(map[string]float64)
+		for _, name := range names {
+			flow += occupancy[name] * cash[name]
+			for dst, p := range to[name] {
+				next[dst] += occupancy[name] * p
+			}
+		}
+		flows = append(flows, flow)
+		occupancy = next
+	}
+	return
+}
+
+// periodCash returns the cash of the node's i'th period.
+func (a *Ast) periodCash(i int) float64 {
+	if a.Flows != nil {
+		return a.Flows[i]
+	}
+	return a.Period.Cash
+}
@@ -0,0 +1,56 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestMarkov(t *testing.T) {
+	buf := []byte(`
+params:
+  churn: .1
+customers:
+  cash: -100
+  days: 30
+  repeat: 3
+  markov:
+    start: {active: 100}
+    states:
+      active:
+        cash: 10
+        to: {active: rest, churned: churn}
+      churned:
+        to: {churned: 1}
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	root := roots[0]
+	want := []float64{900, 800, 710}
+	events := root.Timeline.Events()
+	Tassert(t, len(events) == len(want), "events %d", len(events))
+	for i, e := range events {
+		Tassert(t, math.Abs(e.Cash-want[i]) < 1e-9, "period %d cash %v want %v", i+1, e.Cash, want[i])
+		Tassert(t, e.Date.Equal(now.Add(time.Duration(i+1)*30*24*time.Hour)), "period %d date %v", i+1, e.Date)
+	}
+	Tassert(t, math.Abs(root.Node.Cash-2410) < 1e-9, "node cash %v", root.Node.Cash)
+	Tassert(t, math.Abs(root.Expected.Cash-2410) < 1e-9, "expected cash %v", root.Expected.Cash)
+}
+
+func TestMarkovErrors(t *testing.T) {
+	mk := &Markov{
+		Start:  map[string]string{"a": "1"},
+		States: map[string]MarkovState{"a": {To: Paths{"a": ".5", "b": ".4"}}, "b": {To: Paths{"b": "1"}}},
+	}
+	_, err := mk.flows(nil, 2)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "add up to"), "got %v", err)
+	mk.States["a"] = MarkovState{To: Paths{"c": "1"}}
+	_, err = mk.flows(nil, 2)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "no such state: c"), "got %v", err)
+}
@@ -0,0 +1,84 @@
+package tree
+
+import (
+	"sort"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// Model is a parsed YAML file: the nodes plus any model-level
+// sections.  The model-level keys are reserved and can't be used as
+// node names.
+type Model struct {
+	Include       []Include           `yaml:",omitempty"`
+	Params        map[string]string   `yaml:",omitempty"`
+	Templates     Nodes               `yaml:",omitempty"`
+	Submodels     map[string]Submodel `yaml:",omitempty"`
+	State         map[string]string   `yaml:",omitempty"`
+	Uncertainties Uncertainties       `yaml:",omitempty"`
+	Tests         map[string]Test     `yaml:",omitempty"`
+	Criteria      map[string]string   `yaml:",omitempty"`
+	Capacity      map[string]string   `yaml:",omitempty"`
+	Budget        *Budget             `yaml:",omitempty"`
+	Calendar      *CalendarSpec       `yaml:",omitempty"`
+	Nodes         Nodes               `yaml:",inline"`
+
+	nodes    Nodes
+	vars     Vars
+	state    Vars
+	dynamic  bool
+	calendar *Calendar
+	sources  map[string]string
+	outcomes map[string]map[string]string
+	criteria map[string]float64
+	capacity map[string]float64
+	budget   *budget
+	ends     map[string][]*Ast // by node name, during Recalc
+}
+
+// ToAst converts the model's nodes to one Ast tree per root node.
+func (m *Model) ToAst() (roots []*Ast) {
+	var err error
+	m.vars, err = resolveParams(m.Params)
+	Ck(err)
+	err = m.resolveCriteria()
+	Ck(err)
+	err = m.resolveCapacity()
+	Ck(err)
+	err = m.resolveBudget()
+	Ck(err)
+
+	// work on a copy so the caller's nodes are left as written
+	m.nodes = make(Nodes, len(m.Nodes))
+	m.outcomes = nil
+	for name, node := range m.Nodes {
+		m.nodes[name] = node
+	}
+	err = m.expandSubmodels()
+	Ck(err)
+	err = m.applyTemplates()
+	Ck(err)
+	err = m.expandGenerators()
+	Ck(err)
+	err = m.resolveOutcomeRefs()
+	Ck(err)
+	err = m.resolveState()
+	Ck(err)
+	err = m.resolveRefs()
+	Ck(err)
+	m.calendar, err = m.Calendar.Load()
+	Ck(err)
+
+	// get the root nodes (as a map)
+	rootNodes := m.nodes.RootNodes()
+	var rootNames []string
+	for name := range rootNodes {
+		rootNames = append(rootNames, name)
+	}
+	sort.Strings(rootNames)
+	for _, name := range rootNames {
+		root := m.toAst(name)
+		roots = append(roots, root)
+	}
+	return
+}
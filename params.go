@@ -0,0 +1,106 @@
+package tree
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/soudy/mathcat"
+)
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Vars holds named values for use in node expressions.
+type Vars map[string]*big.Rat
+
+// With returns a copy of vars with other's values added.
+func (vars Vars) With(other Vars) (out Vars) {
+	out = make(Vars, len(vars)+len(other))
+	for k, v := range vars {
+		out[k] = v
+	}
+	for k, v := range other {
+		out[k] = v
+	}
+	return
+}
+
+// idents returns the identifiers used in expr.  Lexer errors are
+// ignored here; they are reported when expr is evaluated.
+func idents(expr string) (names []string) {
+	tokens, err := mathcat.Lex(expr)
+	if err != nil {
+		return
+	}
+	for _, tok := range tokens {
+		if tok.Is(mathcat.Ident) {
+			names = append(names, tok.Value)
+		}
+	}
+	return
+}
+
+// resolveParams evaluates the model-level `params:` section.  A param
+// can refer to other params; they are evaluated in dependency order.
+func resolveParams(params map[string]string) (vars Vars, err error) {
+	return resolveVars("params", params, nil)
+}
+
+// resolveVars evaluates a section of named expressions in dependency
+// order.  The expressions can also use the base vars, which the
+// returned vars include.
+func resolveVars(section string, params map[string]string, base Vars) (vars Vars, err error) {
+	vars = base.With(nil)
+	done := make(map[string]bool)
+	var stack []string
+
+	var visit func(name string) error
+	visit = func(name string) (err error) {
+		if done[name] {
+			return
+		}
+		for i, s := range stack {
+			if s == name {
+				cycle := append(stack[i:], name)
+				return fmt.Errorf("%s: cycle: %s", section, strings.Join(cycle, " -> "))
+			}
+		}
+		stack = append(stack, name)
+		expr := params[name]
+		for _, dep := range idents(expr) {
+			if _, ok := params[dep]; ok {
+				err = visit(dep)
+				if err != nil {
+					return
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		rat, err := evalRat(expandAmount(expr), vars)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %q: %v", section, name, expr, err)
+		}
+		vars[name] = rat
+		done[name] = true
+		return
+	}
+
+	var names []string
+	for name := range params {
+		if !identRe.MatchString(name) {
+			err = fmt.Errorf("%s: invalid name: %q", section, name)
+			return
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = visit(name)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package tree
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestResolveParams(t *testing.T) {
+	vars, err := resolveParams(map[string]string{
+		"cost":      "1.2M",
+		"p_success": "0.6",
+		"p_launch":  "p_success * 0.8",
+		"budget":    "cost * 2",
+	})
+	Tassert(t, err == nil, "%v", err)
+	launch, _ := vars["p_launch"].Float64()
+	Tassert(t, math.Abs(launch-0.48) < 1e-9, "p_launch %v", launch)
+	budget, _ := vars["budget"].Float64()
+	Tassert(t, budget == 2.4e6, "budget %v", budget)
+
+	_, err = resolveParams(map[string]string{"a": "b + 1", "b": "a * 2"})
+	Tassert(t, err != nil, "expected cycle error")
+	_, err = resolveParams(map[string]string{"a-b": "1"})
+	Tassert(t, err != nil, "expected invalid name error")
+}
+
+func TestPathProbs(t *testing.T) {
+	vars, err := resolveParams(map[string]string{"p": "0.5"})
+	Tassert(t, err == nil, "%v", err)
+
+	probs, err := Paths{"a": "1/3", "b": "p * 0.5", "c": "rest"}.Probs(vars)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, math.Abs(probs["a"]-1.0/3) < 1e-9, "a %v", probs["a"])
+	Tassert(t, probs["b"] == 0.25, "b %v", probs["b"])
+	Tassert(t, math.Abs(probs["c"]-(1-0.25-1.0/3)) < 1e-9, "c %v", probs["c"])
+
+	_, err = Paths{"a": "rest", "b": "else"}.Probs(vars)
+	Tassert(t, err != nil, "expected error for two rest paths")
+	_, err = Paths{"a": "0.8", "b": "0.7", "c": "rest"}.Probs(vars)
+	Tassert(t, err != nil, "expected error for no probability left")
+	_, err = Paths{"a": "q"}.Probs(vars)
+	Tassert(t, err != nil, "expected error for undefined variable")
+}
+
+func TestParamsInNodes(t *testing.T) {
+	buf := []byte(`
+params:
+  price: 50k
+  p_hit: 1/4
+launch:
+  cash: -price
+  days: 30
+  paths:
+    hit: p_hit
+    miss: else
+hit:
+  cash: price * 10
+  days: 365
+miss:
+  cash: 0
+  days: 365
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	launch := roots[0]
+	Tassert(t, launch.Node.Cash == -50000, "launch cash %v", launch.Node.Cash)
+	hits := launch.Hyperedges[0]
+	Tassert(t, hits.Children[0].Name == "hit" && hits.Prob == 0.25, "hit prob %v", hits.Prob)
+	Tassert(t, launch.Hyperedges[1].Prob == 0.75, "miss prob %v", launch.Hyperedges[1].Prob)
+}
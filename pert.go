@@ -0,0 +1,59 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// A `days:` field can give three estimates instead of one, e.g.
+// `days: 3, 5, 10` or `days: 2w, 3w, 6w`: optimistic, most likely and
+// pessimistic.  The node then takes the PERT mean, (o + 4m + p) / 6,
+// and the PERT variance, ((p - o) / 6)^2, which adds up along the path
+// on the assumption that the durations are independent.  A node with
+// a `due` date gets the probability of ending by then from a normal
+// approximation around its expected end.
+
+// evalPert evaluates a `days:` field to its mean in days and its
+// variance in days squared, which is zero for a single estimate.
+func evalPert(expr string, vars Vars) (mean, variance float64, err error) {
+	parts := splitTop(expr, ',')
+	switch len(parts) {
+	case 1:
+		mean, err = evalDays(expr, vars)
+		return
+	case 3:
+	default:
+		err = fmt.Errorf("%q: want one estimate or three: optimistic, most likely, pessimistic", expr)
+		return
+	}
+	var est [3]float64
+	for i, part := range parts {
+		est[i], err = evalDays(strings.TrimSpace(part), vars)
+		if err != nil {
+			return
+		}
+	}
+	o, m, p := est[0], est[1], est[2]
+	if !(o <= m && m <= p) {
+		err = fmt.Errorf("%q: want optimistic <= most likely <= pessimistic", expr)
+		return
+	}
+	mean = (o + 4*m + p) / 6
+	variance = math.Pow((p-o)/6, 2)
+	return
+}
+
+// onTime returns the probability of ending by due, given the expected
+// end and the variance of the path's duration in days squared.
+func onTime(end, due time.Time, variance float64) float64 {
+	slack := float64(due.Sub(end)) / float64(24*time.Hour)
+	if variance <= 0 {
+		if slack >= 0 {
+			return 1
+		}
+		return 0
+	}
+	return 0.5 * math.Erfc(-slack/math.Sqrt(2*variance))
+}
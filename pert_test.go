@@ -0,0 +1,76 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestEvalPert(t *testing.T) {
+	cases := []struct {
+		expr           string
+		mean, variance float64
+	}{
+		{"7", 7, 0},
+		{"2, 4, 12", 5, 100.0 / 36},
+		{"1w, 2w, 3w", 14, math.Pow(14.0/6, 2)},
+		{"max(1, 2), 2, 8", 3, 1},
+		{"3, 3, 3", 3, 0},
+	}
+	for _, c := range cases {
+		mean, variance, err := evalPert(c.expr, nil)
+		Tassert(t, err == nil, "%s: %v", c.expr, err)
+		Tassert(t, math.Abs(mean-c.mean) < 1e-9, "%s: mean %v want %v", c.expr, mean, c.mean)
+		Tassert(t, math.Abs(variance-c.variance) < 1e-9, "%s: variance %v want %v", c.expr, variance, c.variance)
+	}
+
+	errs := map[string]string{
+		"5, 3, 8":    "optimistic <= most likely <= pessimistic",
+		"1, 2":       "want one estimate or three",
+		"1, 2, 3, 4": "want one estimate or three",
+		"1, x, 3":    "x",
+	}
+	for expr, want := range errs {
+		_, _, err := evalPert(expr, nil)
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%s: got %v, want %q", expr, err, want)
+	}
+}
+
+func TestPert(t *testing.T) {
+	src := `
+design:
+  days: 2, 4, 12
+  paths:
+    build: 1
+build:
+  days: 4, 5, 12
+  repeat: 2
+  due: start+20d
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	design := roots[0]
+	build := design.Hyperedges[0].Children[0]
+
+	// build's mean is 6 days a period, with variance 64/36 a period
+	Tassert(t, build.Node.Duration == 12*24*time.Hour, "build duration %v", build.Node.Duration)
+	want := 100.0/36 + 2*64.0/36
+	Tassert(t, math.Abs(build.Path.Variance-want) < 1e-9, "path variance %v want %v", build.Path.Variance, want)
+
+	// due 3 days after the expected end
+	p := 0.5 * math.Erfc(-3/math.Sqrt(2*want))
+	Tassert(t, math.Abs(build.POnTime-p) < 1e-9, "p(on time) %v want %v", build.POnTime, p)
+	Tassert(t, build.POnTime > .5 && build.POnTime < 1, "p(on time) %v", build.POnTime)
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, Spf("p(on time): %.2f", p)), "missing p(on time) in dot")
+
+	// a single estimate is a yes/no answer
+	Tassert(t, onTime(now, now.Add(time.Hour), 0) == 1, "on time without variance")
+	Tassert(t, onTime(now.Add(time.Hour), now, 0) == 0, "late without variance")
+}
@@ -0,0 +1,247 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// In portfolio mode each root is a candidate project, and the subset
+// of projects with the largest total expected NPV that fits the budget
+// is chosen.  A project costs its peak funding need: the deepest its
+// cumulative cash, undiscounted, goes below zero on its worst path.
+// The budget is the model's cash plus credit line, unless given.  With
+// resources, the peak use of each resource in a project's tree adds up
+// across projects and has to fit the model's capacity.  A project
+// whose nodes have prereqs in another project's tree can only be
+// chosen with that project.
+//
+// Every subset is tried, so the number of projects is limited.  The
+// efficient frontier is the feasible subsets, ignoring the budget,
+// that no other subset beats on both cost and NPV.
+
+// maxProjects bounds the number of roots in a portfolio.
+const maxProjects = 20
+
+// Project is a root as a portfolio candidate.
+type Project struct {
+	Name      string
+	Npv       float64
+	Cost      float64
+	Resources map[string]float64 // peak use
+	Needs     []string           // projects it has prereqs in
+}
+
+// Portfolio is a set of projects.
+type Portfolio struct {
+	Projects  []string
+	Npv       float64
+	Cost      float64
+	Resources map[string]float64
+}
+
+// PortfolioAnalysis is the outcome of SelectPortfolio.
+type PortfolioAnalysis struct {
+	Budget   float64
+	Projects []*Project
+	Best     *Portfolio
+	Frontier []*Portfolio
+}
+
+// SelectPortfolio picks the projects to fund, after Recalc.  A nil
+// budget means the model's; useResources adds the capacity check.
+func SelectPortfolio(roots []*Ast, budget *float64, useResources bool) (pa *PortfolioAnalysis, err error) {
+	if len(roots) > maxProjects {
+		return nil, fmt.Errorf("portfolio: too many projects: %d, at most %d", len(roots), maxProjects)
+	}
+	var m *Model
+	if len(roots) > 0 {
+		m = roots[0].model
+	}
+	if budget == nil {
+		if m == nil || m.budget == nil {
+			return nil, fmt.Errorf("portfolio: no budget")
+		}
+		model := m.budget.cash + m.budget.credit
+		budget = &model
+	}
+	if *budget < 0 {
+		return nil, fmt.Errorf("portfolio: negative budget: %v", *budget)
+	}
+	var capacity map[string]float64
+	if useResources {
+		if m == nil || len(m.capacity) == 0 {
+			return nil, fmt.Errorf("portfolio: no capacity")
+		}
+		capacity = m.capacity
+	}
+
+	pa = &PortfolioAnalysis{Budget: *budget}
+	trees := make(map[string][]int) // node name -> projects it's in
+	for i, root := range roots {
+		p := &Project{Name: root.Name, Npv: root.Expected.Npv, Cost: fundingNeed(root)}
+		if useResources {
+			p.Resources = peakUse(root, capacity)
+		}
+		pa.Projects = append(pa.Projects, p)
+		root.Walk(func(node *Ast) {
+			if in := trees[node.Name]; len(in) == 0 || in[len(in)-1] != i {
+				trees[node.Name] = append(in, i)
+			}
+		})
+	}
+	needs := make([]int, len(roots)) // bitmask of the projects each needs
+	for i, root := range roots {
+		root.Walk(func(node *Ast) {
+			for _, join := range prereqJoins(node.src.Prereqs) {
+				for _, name := range join {
+					// a prereq in the project's own tree, or in
+					// the first other one that has it
+					in := trees[name]
+					if len(in) == 0 || inProjects(in, i) {
+						continue
+					}
+					if j := in[0]; needs[i]&(1<<j) == 0 {
+						needs[i] |= 1 << j
+						pa.Projects[i].Needs = append(pa.Projects[i].Needs, roots[j].Name)
+					}
+				}
+			}
+		})
+		sort.Strings(pa.Projects[i].Needs)
+	}
+
+	var feasible []*Portfolio
+	for set := 0; set < 1<<len(roots); set++ {
+		if p := pa.portfolio(set, needs, capacity); p != nil {
+			feasible = append(feasible, p)
+			if p.Cost <= *budget+1e-9 && (pa.Best == nil || p.Npv > pa.Best.Npv) {
+				pa.Best = p
+			}
+		}
+	}
+	sort.SliceStable(feasible, func(i, j int) bool {
+		if feasible[i].Cost != feasible[j].Cost {
+			return feasible[i].Cost < feasible[j].Cost
+		}
+		return feasible[i].Npv > feasible[j].Npv
+	})
+	best := math.Inf(-1)
+	for _, p := range feasible {
+		if p.Npv > best {
+			pa.Frontier = append(pa.Frontier, p)
+			best = p.Npv
+		}
+	}
+	return
+}
+
+// portfolio returns the set of projects, or nil if it leaves out a
+// project one of them needs, or uses more resources than the capacity.
+func (pa *PortfolioAnalysis) portfolio(set int, needs []int, capacity map[string]float64) (p *Portfolio) {
+	p = &Portfolio{}
+	for i, project := range pa.Projects {
+		if set&(1<<i) == 0 {
+			continue
+		}
+		if needs[i]&set != needs[i] {
+			return nil
+		}
+		p.Projects = append(p.Projects, project.Name)
+		p.Npv += project.Npv
+		p.Cost += project.Cost
+		for name, use := range project.Resources {
+			if p.Resources == nil {
+				p.Resources = make(map[string]float64)
+			}
+			p.Resources[name] += use
+		}
+	}
+	for name, use := range p.Resources {
+		if use > capacity[name] {
+			return nil
+		}
+	}
+	return
+}
+
+// fundingNeed returns how far the cumulative cash of the root's worst
+// path goes below zero.
+func fundingNeed(root *Ast) (need float64) {
+	root.Walk(func(node *Ast) {
+		if len(node.Hyperedges) > 0 {
+			return
+		}
+		var sum float64
+		for _, e := range node.Timeline.Events() {
+			sum += e.Cash
+			need = math.Max(need, -sum)
+		}
+	})
+	return
+}
+
+// peakUse returns the peak use of each resource in the root's tree.
+func peakUse(root *Ast, capacity map[string]float64) (peaks map[string]float64) {
+	peaks = make(map[string]float64)
+	for resource := range capacity {
+		var times []time.Time
+		root.Walk(func(node *Ast) {
+			if node.Resources[resource] != 0 {
+				times = append(times, node.Start)
+			}
+		})
+		for _, t := range times {
+			if d, _ := root.peak(resource, t); d > peaks[resource] {
+				peaks[resource] = d
+			}
+		}
+	}
+	return
+}
+
+// String formats the analysis as a table of projects, the chosen
+// portfolio and the efficient frontier.
+func (pa *PortfolioAnalysis) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "budget: %s\n\n", form(pa.Budget))
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "project\tnpv\tcost\tneeds\t\n")
+	for _, p := range pa.Projects {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", p.Name, form(p.Npv), form(p.Cost), strings.Join(p.Needs, ", "))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(&buf, "\nchosen: ")
+	if pa.Best == nil || len(pa.Best.Projects) == 0 {
+		fmt.Fprintf(&buf, "none\n")
+	} else {
+		fmt.Fprintf(&buf, "%s (npv %s, cost %s)\n", strings.Join(pa.Best.Projects, ", "), form(pa.Best.Npv), form(pa.Best.Cost))
+	}
+
+	fmt.Fprintf(&buf, "\nefficient frontier:\n\n")
+	tw = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "cost\tnpv\tprojects\t\n")
+	for _, p := range pa.Frontier {
+		names := strings.Join(p.Projects, ", ")
+		if names == "" {
+			names = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", form(p.Cost), form(p.Npv), names)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+func inProjects(in []int, i int) bool {
+	for _, j := range in {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+const portfolioYAML = `
+budget:
+  cash: 1M
+  credit: 500k
+capacity:
+  engineers: 5
+alpha:
+  cash: -800k
+  days: 30
+  resources: {engineers: 3}
+  paths:
+    alpha_pay: 1
+alpha_pay:
+  cash: 400k
+  days: 365
+  repeat: 4
+beta:
+  cash: -600k
+  days: 30
+  resources: {engineers: 2}
+  paths:
+    beta_pay: 1
+beta_pay:
+  cash: 250k
+  days: 365
+  repeat: 4
+gamma:
+  cash: -500k
+  days: 30
+  resources: {engineers: 3}
+  paths:
+    gamma_pay: 1
+gamma_pay:
+  cash: 220k
+  days: 365
+  repeat: 4
+`
+
+func TestPortfolio(t *testing.T) {
+	roots, err := FromYAML([]byte(portfolioYAML))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	// the model's budget is cash plus credit
+	pa, err := SelectPortfolio(roots, nil, false)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, pa.Budget == 1500000, "budget %v", pa.Budget)
+	Tassert(t, pa.Projects[0].Name == "alpha" && pa.Projects[0].Cost == 800000, "alpha %v", pa.Projects[0])
+	got := strings.Join(pa.Best.Projects, ", ")
+	Tassert(t, got == "alpha, beta" && pa.Best.Cost == 1400000, "chose %s, cost %v", got, pa.Best.Cost)
+	var frontier []string
+	for _, p := range pa.Frontier {
+		frontier = append(frontier, strings.Join(p.Projects, "+"))
+	}
+	got = strings.Join(frontier, " ")
+	Tassert(t, got == " gamma beta alpha alpha+gamma alpha+beta alpha+beta+gamma", "frontier %q", got)
+
+	// a smaller budget
+	budget := 1.2e6
+	pa, err = SelectPortfolio(roots, &budget, false)
+	Tassert(t, err == nil, "%v", err)
+	got = strings.Join(pa.Best.Projects, ", ")
+	Tassert(t, got == "alpha", "chose %s", got)
+
+	// alpha and gamma need 6 engineers together
+	budget = 2e6
+	pa, err = SelectPortfolio(roots, &budget, true)
+	Tassert(t, err == nil, "%v", err)
+	got = strings.Join(pa.Best.Projects, ", ")
+	Tassert(t, got == "alpha, beta", "chose %s", got)
+	Tassert(t, pa.Best.Resources["engineers"] == 5, "engineers %v", pa.Best.Resources)
+	Tassert(t, strings.Contains(pa.String(), "chosen: alpha, beta (npv "), "got %s", pa.String())
+
+	// an explicit zero budget funds nothing rather than the model's
+	budget = 0
+	pa, err = SelectPortfolio(roots, &budget, false)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, pa.Budget == 0 && len(pa.Best.Projects) == 0, "budget %v, chose %v", pa.Budget, pa.Best.Projects)
+}
+
+func TestPortfolioPrereqs(t *testing.T) {
+	src := `
+budget:
+  cash: 10M
+platform:
+  cash: -1M
+  days: 30
+app:
+  cash: 3M
+  days: 30
+  prereqs: [platform]
+`
+	roots, err := FromYAML([]byte(src))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	pa, err := SelectPortfolio(roots, nil, false)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, strings.Join(pa.Projects[0].Needs, ",") == "platform", "app needs %v", pa.Projects[0].Needs)
+	// the platform loses money, but the app can't go without it
+	got := strings.Join(pa.Best.Projects, ", ")
+	Tassert(t, got == "app, platform", "chose %s", got)
+	for _, p := range pa.Frontier {
+		Tassert(t, strings.Join(p.Projects, ",") != "app", "app alone on the frontier")
+	}
+}
+
+func TestPortfolioErrors(t *testing.T) {
+	roots, err := FromYAML([]byte("a: {cash: -1, days: 1}"))
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, time.Now(), testWarn(t))
+	_, err = SelectPortfolio(roots, nil, false)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "no budget"), "got %v", err)
+	budget := -1.0
+	_, err = SelectPortfolio(roots, &budget, false)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "negative budget"), "got %v", err)
+	budget = 100
+	_, err = SelectPortfolio(roots, &budget, true)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "no capacity"), "got %v", err)
+}
@@ -0,0 +1,237 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A risk profile is the discrete distribution of the leaf outcomes
+// reachable from a root, or from one alternative of a decision (see
+// AnalyzeScenarios for which nodes are decisions).  Profiles can be
+// compared for stochastic dominance: A dominates B in the first order
+// if A is at least as likely as B to beat every NPV, and in the
+// second order if the area under A's cumulative distribution never
+// exceeds B's, which every risk-averse decision maker prefers.
+
+// Profile is the outcome distribution of a root or an alternative.
+type Profile struct {
+	Name     string
+	Outcomes []LeafOutcome // sorted by NPV
+}
+
+// Dominance is a stochastic dominance relation between two profiles.
+type Dominance struct {
+	Better, Worse string
+	Order         int // 1 or 2
+}
+
+// Profiles returns the risk profile of each root and of each
+// alternative of each decision, after Recalc.  A root that is itself a
+// decision is left out, since its alternatives are listed.
+func Profiles(roots []*Ast) (profiles []*Profile) {
+	for _, root := range roots {
+		if root.Decision {
+			continue
+		}
+		profiles = append(profiles, &Profile{Name: root.Name, Outcomes: root.Distribution()})
+	}
+	for _, node := range decisionNodes(roots) {
+		for _, hedge := range node.Hyperedges {
+			outcomes := jointDist(node, hedge.Children)
+			sort.SliceStable(outcomes, func(i, j int) bool { return outcomes[i].Npv < outcomes[j].Npv })
+			profiles = append(profiles, &Profile{Name: node.Name + " -> " + hedge.Path, Outcomes: outcomes})
+		}
+	}
+	return
+}
+
+// decisionNodes returns the nodes marked as decisions, or the roots
+// if there are none.
+func decisionNodes(roots []*Ast) (decisions []*Ast) {
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		if node.Decision {
+			decisions = append(decisions, node)
+		}
+		for _, hedge := range node.Hyperedges {
+			for _, child := range hedge.Children {
+				walk(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	if len(decisions) == 0 {
+		decisions = roots
+	}
+	return
+}
+
+// Cdf returns the probability that the NPV is at most npv.
+func (p *Profile) Cdf(npv float64) (cum float64) {
+	for _, o := range p.Outcomes {
+		if o.Npv > npv {
+			break
+		}
+		cum += o.Prob
+	}
+	return
+}
+
+// area returns the integral of the cdf from the lowest outcome up to
+// npv.
+func (p *Profile) area(npv float64) (sum float64) {
+	cum := 0.0
+	for i, o := range p.Outcomes {
+		if o.Npv >= npv {
+			break
+		}
+		cum += o.Prob
+		next := npv
+		if i+1 < len(p.Outcomes) && p.Outcomes[i+1].Npv < npv {
+			next = p.Outcomes[i+1].Npv
+		}
+		sum += cum * (next - o.Npv)
+	}
+	return
+}
+
+// Dominates reports whether p dominates q in the first and in the
+// second order.
+func (p *Profile) Dominates(q *Profile) (first, second bool) {
+	const eps = 1e-9
+	var xs []float64
+	for _, o := range p.Outcomes {
+		xs = append(xs, o.Npv)
+	}
+	for _, o := range q.Outcomes {
+		xs = append(xs, o.Npv)
+	}
+	sort.Float64s(xs)
+	first, second = true, true
+	strict1, strict2 := false, false
+	for _, x := range xs {
+		fp, fq := p.Cdf(x), q.Cdf(x)
+		if fp > fq+eps {
+			first = false
+		}
+		if fp < fq-eps {
+			strict1 = true
+		}
+		ap, aq := p.area(x), q.area(x)
+		if ap > aq+eps*math.Max(1, math.Abs(aq)) {
+			second = false
+		}
+		if ap < aq-eps*math.Max(1, math.Abs(aq)) {
+			strict2 = true
+		}
+	}
+	first = first && strict1
+	// first order dominance implies second order
+	second = second && (strict2 || strict1)
+	return
+}
+
+// Dominances returns the dominance relations between the
+// alternatives of the same decision, and between the roots.
+func Dominances(profiles []*Profile) (ds []Dominance) {
+	groups := make(map[string][]*Profile)
+	var keys []string
+	for _, p := range profiles {
+		key := ""
+		if i := strings.Index(p.Name, " -> "); i >= 0 {
+			key = p.Name[:i]
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], p)
+	}
+	for _, key := range keys {
+		group := groups[key]
+		for _, p := range group {
+			for _, q := range group {
+				if p == q {
+					continue
+				}
+				first, second := p.Dominates(q)
+				switch {
+				case first:
+					ds = append(ds, Dominance{Better: p.Name, Worse: q.Name, Order: 1})
+				case second:
+					ds = append(ds, Dominance{Better: p.Name, Worse: q.Name, Order: 2})
+				}
+			}
+		}
+	}
+	return
+}
+
+// ProfileText lists the profiles' outcomes and the dominance
+// relations between them.
+func ProfileText(profiles []*Profile) string {
+	var buf bytes.Buffer
+	for _, p := range profiles {
+		fmt.Fprintf(&buf, "%s:\n", p.Name)
+		tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprint(tw, "prob\tcum\tnpv\tend\tleaf\t\n")
+		cum := 0.0
+		for _, o := range p.Outcomes {
+			cum += o.Prob
+			late := ""
+			if o.Late {
+				late = " (late)"
+			}
+			fmt.Fprintf(tw, "%.3f\t%.3f\t%s\t%s%s\t%s\t\n", o.Prob, cum, form(o.Npv), o.End.Format("2006-01-02"), late, o.name())
+		}
+		tw.Flush()
+		fmt.Fprintln(&buf)
+	}
+	ds := Dominances(profiles)
+	if len(ds) == 0 {
+		fmt.Fprintln(&buf, "no stochastic dominance")
+	}
+	for _, d := range ds {
+		order := "first"
+		if d.Order == 2 {
+			order = "second"
+		}
+		fmt.Fprintf(&buf, "%s dominates %s (%s order)\n", d.Better, d.Worse, order)
+	}
+	return buf.String()
+}
+
+// name names the outcome by its leaves.
+func (o LeafOutcome) name() string {
+	var names []string
+	for _, leaf := range o.Leaves {
+		names = append(names, leaf.Name)
+	}
+	return strings.Join(names, "+")
+}
+
+// ProfileSVG draws the cumulative risk profiles.
+func ProfileSVG(profiles []*Profile) []byte {
+	var series []svgSeries
+	for _, p := range profiles {
+		s := svgSeries{Name: p.Name, Step: true}
+		cum := 0.0
+		for _, o := range p.Outcomes {
+			if len(s.X) == 0 {
+				s.X = append(s.X, o.Npv)
+				s.Y = append(s.Y, 0)
+			}
+			cum += o.Prob
+			s.X = append(s.X, o.Npv)
+			s.Y = append(s.Y, cum)
+		}
+		series = append(series, s)
+	}
+	return svgChart("cumulative risk profile", "NPV", "P(NPV <= x)", series, form,
+		func(y float64) string { return fmt.Sprintf("%.1f", y) })
+}
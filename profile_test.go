@@ -0,0 +1,77 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestDominates(t *testing.T) {
+	// a is b shifted up: first order
+	a := &Profile{Name: "a", Outcomes: []LeafOutcome{{Prob: .5, Npv: 0}, {Prob: .5, Npv: 20}}}
+	b := &Profile{Name: "b", Outcomes: []LeafOutcome{{Prob: .5, Npv: -10}, {Prob: .5, Npv: 10}}}
+	first, second := a.Dominates(b)
+	Tassert(t, first && second, "a over b: %v %v", first, second)
+	first, second = b.Dominates(a)
+	Tassert(t, !first && !second, "b over a: %v %v", first, second)
+
+	// c has b's mean with less spread: second order only
+	c := &Profile{Name: "c", Outcomes: []LeafOutcome{{Prob: 1, Npv: 0}}}
+	first, second = c.Dominates(b)
+	Tassert(t, !first && second, "c over b: %v %v", first, second)
+	first, second = b.Dominates(c)
+	Tassert(t, !first && !second, "b over c: %v %v", first, second)
+
+	// nothing dominates itself
+	first, second = a.Dominates(a)
+	Tassert(t, !first && !second, "a over a: %v %v", first, second)
+}
+
+func TestProfiles(t *testing.T) {
+	data, err := testFS.ReadFile("examples/hbr.yaml")
+	Tassert(t, err == nil, "%v", err)
+	roots, err := FromYAML(data)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	profiles := Profiles(roots)
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+		total := 0.0
+		for _, o := range p.Outcomes {
+			total += o.Prob
+		}
+		Tassert(t, total > .999 && total < 1.001, "%s sums to %v", p.Name, total)
+	}
+	got := strings.Join(names, "; ")
+	want := "dp1 -> big; dp1 -> small; dp2 -> expand; dp2 -> nochange"
+	Tassert(t, got == want, "got %s", got)
+	Tassert(t, profiles[0].Cdf(0) > .399 && profiles[0].Cdf(0) < .401, "big p(npv <= 0) %v", profiles[0].Cdf(0))
+
+	ds := Dominances(profiles)
+	Tassert(t, len(ds) == 1, "got %v", ds)
+	Tassert(t, ds[0].Better == "dp2 -> nochange" && ds[0].Order == 1, "got %v", ds[0])
+
+	text := ProfileText(profiles)
+	Tassert(t, strings.Contains(text, "dp2 -> nochange dominates dp2 -> expand (first order)"), "got %s", text)
+	svg := string(ProfileSVG(profiles))
+	Tassert(t, strings.HasPrefix(svg, "<svg") && strings.Count(svg, "<polyline") == 4, "got %s", svg)
+}
+
+func TestProfileJoint(t *testing.T) {
+	roots, err := FromYAML([]byte(jointYAML))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	// the root and its one alternative, with the root's cash once
+	profiles := Profiles(roots)
+	Tassert(t, len(profiles) == 2 && profiles[1].Name == "root -> a,b", "got %v", profiles)
+	for _, p := range profiles {
+		Tassert(t, p.Cdf(-81) == 0 && p.Cdf(-80) == .5 && p.Cdf(60) == 1, "%s cdf %v %v %v", p.Name, p.Cdf(-81), p.Cdf(-80), p.Cdf(60))
+	}
+}
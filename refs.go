@@ -0,0 +1,220 @@
+package tree
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// Node expressions can refer to other nodes' fields, e.g.
+//
+//	cash: big.cash * -0.1
+//	days: design.days / 2
+//
+// A reference evaluates to the referenced field's own value, per
+// period and before repeat; `repeat` is at least 1, and `days` is the
+// mean of a three-point estimate.  References are resolved in
+// dependency order when the model is converted to Ast trees; a cycle
+// is an error.
+
+var refFields = []string{"cash", "days", "workdays", "repeat"}
+
+type refKey struct {
+	name  string
+	field string
+}
+
+func (k refKey) String() string {
+	return k.name + "." + k.field
+}
+
+type refResolver struct {
+	m      *Model
+	re     *regexp.Regexp
+	idents map[refKey]string
+	vals   Vars
+	stack  []refKey
+}
+
+// resolveRefs replaces cross-node references in the working nodes
+// with variables holding the referenced values.
+func (m *Model) resolveRefs() (err error) {
+	re := m.refPattern()
+	if re == nil {
+		return
+	}
+	r := &refResolver{
+		m:      m,
+		re:     re,
+		idents: make(map[refKey]string),
+		vals:   make(Vars),
+	}
+
+	var nodeNames []string
+	for name := range m.nodes {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+	for _, name := range nodeNames {
+		node := m.nodes[name]
+		rewrite := func(expr string) string {
+			out, rerr := r.rewrite(expr)
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			return out
+		}
+		node.Cash = rewrite(node.Cash)
+		node.Days = rewrite(node.Days)
+		node.Workdays = rewrite(node.Workdays)
+		node.Repeat = rewrite(node.Repeat)
+		node.When = rewrite(node.When)
+		node.Paths = rewriteMap(node.Paths, rewrite)
+		node.Set = rewriteMap(node.Set, rewrite)
+		if err != nil {
+			return
+		}
+		m.nodes[name] = node
+	}
+	m.vars = m.vars.With(r.vals)
+	return
+}
+
+// refPattern returns a pattern that matches references to the working
+// nodes' fields, or nil if there are no nodes.
+func (m *Model) refPattern() *regexp.Regexp {
+	var names []string
+	for name := range m.nodes {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// longest first, so `ns/big` wins over `big`
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	pattern := Spf(`(^|[^\w.])(%s)\.(%s)\b`, strings.Join(names, "|"), strings.Join(refFields, "|"))
+	return regexp.MustCompile(pattern)
+}
+
+// noRefs returns an error if expr refers to another node's field.
+// Generators are expanded before references are resolved, so the
+// expressions that shape the expansion can't use them.
+func (m *Model) noRefs(expr string) (err error) {
+	re := m.refPattern()
+	if re == nil {
+		return
+	}
+	if match := re.FindStringSubmatch(expr); match != nil {
+		err = fmt.Errorf("can't refer to %s.%s here, use a param instead", match[2], match[3])
+	}
+	return
+}
+
+// rewriteMap returns a copy of map in with rewritten values.
+func rewriteMap(in map[string]string, rewrite func(string) string) (out map[string]string) {
+	if in == nil {
+		return
+	}
+	out = make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = rewrite(v)
+	}
+	return
+}
+
+// rewrite replaces the references in expr with variable names,
+// resolving each referenced value first.
+func (r *refResolver) rewrite(expr string) (out string, err error) {
+	out = r.re.ReplaceAllStringFunc(expr, func(s string) string {
+		m := r.re.FindStringSubmatch(s)
+		key := refKey{m[2], m[3]}
+		ident, rerr := r.resolve(key)
+		if rerr != nil {
+			if err == nil {
+				err = rerr
+			}
+			return s
+		}
+		return m[1] + ident
+	})
+	return
+}
+
+// resolve evaluates a referenced field and returns the name of the
+// variable holding its value.
+func (r *refResolver) resolve(key refKey) (ident string, err error) {
+	ident, ok := r.idents[key]
+	if ok {
+		return
+	}
+	for i, k := range r.stack {
+		if k == key {
+			var cycle []string
+			for _, k := range append(r.stack[i:], key) {
+				cycle = append(cycle, k.String())
+			}
+			err = fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+			return
+		}
+	}
+	r.stack = append(r.stack, key)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	node := r.m.nodes[key.name]
+	var expr string
+	switch key.field {
+	case "cash":
+		expr = node.Cash
+	case "days":
+		expr = node.Days
+	case "workdays":
+		expr = node.Workdays
+	case "repeat":
+		expr = node.Repeat
+	}
+	expr, err = r.rewrite(expr)
+	if err != nil {
+		return
+	}
+	local, err := resolveVars("vars", node.Vars, r.m.vars)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", key, err)
+		return
+	}
+	vars := local.With(r.m.state).With(r.vals)
+	var val float64
+	switch key.field {
+	case "cash":
+		val, err = evalAmount(expr, vars)
+	case "days":
+		// the mean of a three-point estimate
+		val, _, err = evalPert(expr, vars)
+	case "repeat":
+		// same as Ast.Repeat: at least one period
+		val, err = evalFloat(expr, vars)
+		val = math.Max(1, val)
+	default:
+		val, err = evalFloat(expr, vars)
+	}
+	if err == nil && (math.IsNaN(val) || math.IsInf(val, 0)) {
+		err = fmt.Errorf("not a finite number: %v", val)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %v", key, err)
+		return
+	}
+	ident = Spf("_ref%d", len(r.idents))
+	r.idents[key] = ident
+	r.vals[ident] = new(big.Rat).SetFloat64(val)
+	return
+}
@@ -0,0 +1,81 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestRefs(t *testing.T) {
+	buf := []byte(`
+params:
+  scale: 2
+root:
+  paths:
+    big: 0.5
+    big-fee: 0.5
+big:
+  cash: -3M
+  days: 2w
+big-fee:
+  cash: -big.cash * 0.1
+  days: design.days / 2
+  repeat: big.repeat * scale
+design:
+  days: big.days * scale
+`)
+	var model Model
+	err := yamlUnmarshal(buf, &model)
+	Tassert(t, err == nil, "%v", err)
+	roots := model.ToAst()
+	Tassert(t, len(roots) == 2, "roots %d", len(roots))
+	// the caller's nodes are left as written
+	Tassert(t, model.Nodes["big-fee"].Cash == "-big.cash * 0.1", "nodes modified: %s", model.Nodes["big-fee"].Cash)
+
+	var fee *Ast
+	for _, root := range roots {
+		if root.Name == "root" {
+			fee = root.Hyperedges[1].Children[0]
+		}
+	}
+	Tassert(t, fee.Name == "big-fee", "got %s", fee.Name)
+	Tassert(t, fee.Period.Cash == 300000, "fee cash %v", fee.Period.Cash)
+	Tassert(t, fee.Repeat == 2, "fee repeat %v", fee.Repeat)
+	Tassert(t, fee.Period.Duration.Hours() == 14*24, "fee days %v", fee.Period.Duration)
+}
+
+func TestRefPert(t *testing.T) {
+	buf := []byte(`
+design:
+  days: 2, 5, 14
+  paths:
+    build: 1
+build:
+  days: design.days / 2
+`)
+	var model Model
+	err := yamlUnmarshal(buf, &model)
+	Tassert(t, err == nil, "%v", err)
+	roots := model.ToAst()
+	build := roots[0].Hyperedges[0].Children[0]
+	// the mean is (2 + 4*5 + 14) / 6 = 6 days
+	Tassert(t, build.Period.Duration.Hours() == 3*24, "build days %v", build.Period.Duration)
+	Tassert(t, build.Node.Variance == 0, "build variance %v", build.Node.Variance)
+}
+
+func TestRefCycle(t *testing.T) {
+	buf := []byte(`
+a:
+  cash: b.cash + 1
+  paths:
+    b: 1
+b:
+  cash: c.cash * 2
+c:
+  cash: a.cash
+`)
+	_, err := FromYAML(buf)
+	Tassert(t, err != nil, "expected cycle error")
+	Tassert(t, strings.Contains(err.Error(), "cycle: b.cash -> c.cash -> a.cash -> b.cash"), "got %v", err)
+}
@@ -0,0 +1,234 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Nodes can declare the resources they tie up while they run, and the
+// model the capacity of each:
+//
+//	capacity:
+//	  engineers: 3
+//	backend:
+//	  days: 14
+//	  resources:
+//	    engineers: 2
+//
+// Nodes that can happen together -- the children of one path, their
+// subtrees, and the nodes of different trees -- add up while their
+// start to end overlaps, while the alternative paths out of a node
+// never do.  Overallocations reports where the busiest combination
+// needs more than the capacity.  With Options.Leveling, RecalcWith
+// delays nodes until they fit, one conflict at a time: of the nodes
+// in the earliest overallocation, the one that starts last (with the
+// most float, on a tie) waits until another one ends.
+
+// maxLeveling bounds the number of delays RecalcWith makes when
+// leveling.
+const maxLeveling = 1000
+
+// Overallocation is a time span where a resource is overallocated.
+type Overallocation struct {
+	Resource string
+	Start    time.Time
+	End      time.Time
+	Demand   float64
+	Capacity float64
+	Nodes    []*Ast // the busiest combination of nodes
+}
+
+func (o Overallocation) String() string {
+	var names []string
+	for _, node := range o.Nodes {
+		names = append(names, node.Name)
+	}
+	return fmt.Sprintf("%s: %v > %v from %s to %s: %s", o.Resource, o.Demand, o.Capacity,
+		o.Start.Format("2006-01-02"), o.End.Format("2006-01-02"), strings.Join(names, ", "))
+}
+
+// resolveCapacity evaluates the resource capacities.
+func (m *Model) resolveCapacity() (err error) {
+	m.capacity = nil
+	for name, expr := range m.Capacity {
+		if !identRe.MatchString(name) {
+			return fmt.Errorf("capacity: invalid name: %q", name)
+		}
+		var c float64
+		c, err = evalFloat(expr, m.vars)
+		if err != nil {
+			return fmt.Errorf("capacity: %s: %v", name, err)
+		}
+		if m.capacity == nil {
+			m.capacity = make(map[string]float64)
+		}
+		m.capacity[name] = c
+	}
+	return
+}
+
+// evalResources sets the node's resource usage.
+func (a *Ast) evalResources(vars Vars) (err error) {
+	a.Resources = nil
+	for name, expr := range a.src.Resources {
+		if !identRe.MatchString(name) {
+			return fmt.Errorf("resources: invalid name: %q", name)
+		}
+		var v float64
+		v, err = evalFloat(expr, vars)
+		if err != nil {
+			return fmt.Errorf("resources: %s: %v", name, err)
+		}
+		if a.Resources == nil {
+			a.Resources = make(map[string]float64)
+		}
+		a.Resources[name] = v
+	}
+	return
+}
+
+// Overallocations returns the spans, after Recalc, where the nodes
+// that can run at the same time need more of a resource than the
+// model's capacity, ordered by start and resource.
+func Overallocations(roots []*Ast) (over []Overallocation) {
+	if len(roots) == 0 || roots[0].model == nil {
+		return
+	}
+	capacity := roots[0].model.capacity
+	var resources []string
+	for name := range capacity {
+		resources = append(resources, name)
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		// the times where the demand can change
+		var times []time.Time
+		for _, root := range roots {
+			root.Walk(func(node *Ast) {
+				if node.Resources[resource] != 0 && node.End.After(node.Start) {
+					times = append(times, node.Start, node.End)
+				}
+			})
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+		var last *Overallocation
+		for i := 0; i+1 < len(times); i++ {
+			t := times[i]
+			if !times[i+1].After(t) {
+				continue
+			}
+			var demand float64
+			var nodes []*Ast
+			for _, root := range roots {
+				d, ns := root.peak(resource, t)
+				demand += d
+				nodes = append(nodes, ns...)
+			}
+			if demand <= capacity[resource] {
+				last = nil
+				continue
+			}
+			if last != nil && last.Demand == demand && sameNodes(last.Nodes, nodes) {
+				last.End = times[i+1]
+				continue
+			}
+			over = append(over, Overallocation{
+				Resource: resource,
+				Start:    t,
+				End:      times[i+1],
+				Demand:   demand,
+				Capacity: capacity[resource],
+				Nodes:    nodes,
+			})
+			last = &over[len(over)-1]
+		}
+	}
+	sort.SliceStable(over, func(i, j int) bool { return over[i].Start.Before(over[j].Start) })
+	return
+}
+
+// peak returns the largest demand for resource at time t under the
+// node, taking the busiest of the alternative paths, and the nodes
+// making it up.
+func (a *Ast) peak(resource string, t time.Time) (demand float64, nodes []*Ast) {
+	if use := a.Resources[resource]; use != 0 && !t.Before(a.Start) && t.Before(a.End) {
+		demand = use
+		nodes = []*Ast{a}
+	}
+	var best float64
+	var bestNodes []*Ast
+	for _, hedge := range a.Hyperedges {
+		var d float64
+		var ns []*Ast
+		for _, child := range hedge.Children {
+			cd, cns := child.peak(resource, t)
+			d += cd
+			ns = append(ns, cns...)
+		}
+		if d > best {
+			best, bestNodes = d, ns
+		}
+	}
+	return demand + best, append(nodes, bestNodes...)
+}
+
+func sameNodes(a, b []*Ast) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// level delays nodes until no resource is overallocated, or until
+// only single nodes that need more than the capacity on their own
+// are left.
+func level(roots []*Ast, now time.Time, warn Warn, opts Options) {
+	quiet := func(args ...interface{}) {}
+	for i := 0; i < maxLeveling; i++ {
+		var node *Ast
+		var start time.Time
+		for _, o := range Overallocations(roots) {
+			node, start = o.delay()
+			if node != nil {
+				break
+			}
+		}
+		if node == nil {
+			return
+		}
+		node.LevelStart = start
+		recalc(roots, now, quiet, opts)
+	}
+	warn("leveling: gave up after %d delays\n", maxLeveling)
+}
+
+// delay picks the node to delay to resolve the overallocation, and
+// when it should start.
+func (o Overallocation) delay() (node *Ast, start time.Time) {
+	if len(o.Nodes) < 2 {
+		return
+	}
+	for _, n := range o.Nodes {
+		switch {
+		case node == nil, n.Start.After(node.Start):
+			node = n
+		case n.Start.Equal(node.Start) && n.Float > node.Float:
+			node = n
+		}
+	}
+	for _, n := range o.Nodes {
+		if n != node && n.End.After(node.Start) && (start.IsZero() || n.End.Before(start)) {
+			start = n.End
+		}
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+const resourcesYAML = `
+capacity:
+  engineers: team
+params:
+  team: 3
+plan:
+  days: 1
+  paths:
+    backend,frontend: .5
+    prototype: .5
+backend:
+  days: 10
+  resources:
+    engineers: 2
+frontend:
+  days: 5
+  resources:
+    engineers: 2
+prototype:
+  days: 20
+  resources:
+    engineers: 3
+`
+
+func TestOverallocations(t *testing.T) {
+	roots, err := FromYAML([]byte(resourcesYAML))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var warnings []string
+	warn := func(args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(args[0].(string), args[1:]...))
+	}
+	Recalc(roots, now, warn)
+
+	// the prototype is an alternative, so it doesn't add up with the
+	// others
+	over := Overallocations(roots)
+	Tassert(t, len(over) == 1, "got %v", over)
+	o := over[0]
+	Tassert(t, o.Resource == "engineers" && o.Demand == 4 && o.Capacity == 3, "got %v", o)
+	Tassert(t, o.Start.Equal(now.AddDate(0, 0, 1)) && o.End.Equal(now.AddDate(0, 0, 6)), "got %v", o)
+	got := o.String()
+	want := "engineers: 4 > 3 from 2023-01-02 to 2023-01-07: backend, frontend"
+	Tassert(t, got == want, "got %q want %q", got, want)
+	Tassert(t, strings.Contains(strings.Join(warnings, ""), "overallocated: "+want), "got %v", warnings)
+}
+
+func TestLeveling(t *testing.T) {
+	roots, err := FromYAML([]byte(resourcesYAML))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	opts := Options{Leveling: true}
+	RecalcWith(roots, now, testWarn(t), opts)
+
+	Tassert(t, len(Overallocations(roots)) == 0, "got %v", Overallocations(roots))
+	// frontend has more float, so it waits for the backend
+	plan := roots[0]
+	backend := plan.Hyperedges[0].Children[0]
+	frontend := plan.Hyperedges[0].Children[1]
+	Tassert(t, backend.Name == "backend" && frontend.Name == "frontend", "got %s %s", backend.Name, frontend.Name)
+	Tassert(t, backend.Start.Equal(now.AddDate(0, 0, 1)), "backend start %v", backend.Start)
+	Tassert(t, frontend.Start.Equal(backend.End), "frontend start %v", frontend.Start)
+	Tassert(t, frontend.Idle == 10*24*time.Hour, "frontend idle %v", frontend.Idle)
+
+	// recalculating gives the same schedule
+	end := frontend.End
+	npv := plan.Expected.Npv
+	RecalcWith(roots, now, testWarn(t), opts)
+	Tassert(t, frontend.End.Equal(end), "frontend end %v want %v", frontend.End, end)
+	Tassert(t, plan.Expected.Npv == npv, "npv %v want %v", plan.Expected.Npv, npv)
+
+	// turning leveling off drops the delays, and turning it back on
+	// brings them back
+	RecalcWith(roots, now, func(args ...interface{}) {}, Options{})
+	Tassert(t, frontend.LevelStart.IsZero(), "frontend level start %v", frontend.LevelStart)
+	Tassert(t, frontend.Start.Equal(backend.Start), "frontend start %v", frontend.Start)
+	Tassert(t, len(Overallocations(roots)) == 1, "got %v", Overallocations(roots))
+	RecalcWith(roots, now, testWarn(t), opts)
+	Tassert(t, frontend.End.Equal(end), "frontend end %v want %v", frontend.End, end)
+}
+
+func TestResourceErrors(t *testing.T) {
+	cases := map[string]string{
+		"capacity: {engineers: x}\na: {days: 1}": "capacity: engineers",
+		"capacity: {bad-name: 1}\na: {days: 1}":  "capacity: invalid name",
+	}
+	for src, want := range cases {
+		_, err := FromYAML([]byte(src))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: got %v, want %q", src, err, want)
+	}
+}
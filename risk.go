@@ -0,0 +1,167 @@
+package tree
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultRiskLevel is the confidence level of the value-at-risk and
+// CVaR unless Options say otherwise: 0.95 looks at the worst 5% of
+// outcomes.
+const DefaultRiskLevel = 0.95
+
+// Risk describes the spread of the leaf outcomes under a node, from
+// the discrete distribution of leaves Backward rolls up.  VaR and CVaR
+// are losses: VaR is the NPV loss that is exceeded with probability
+// of at most 1 - Level, and CVaR is the expected loss in that tail.
+// Negative values mean even the tail makes money.
+type Risk struct {
+	Level    float64 // confidence level of VaR and CVaR
+	StdevNpv float64
+	PLoss    float64 // probability of NPV < 0
+	PLate    float64 // probability of missing a due date on the way
+	PBroke   float64 // probability of running out of money, with a budget
+	VaR      float64
+	CVaR     float64
+}
+
+// LeafOutcome is one outcome reachable from a node, with its
+// probability as seen from that node.  Under a joint path the
+// children run in parallel, so an outcome is one leaf of each child
+// together: the path up to the fork counts once, what comes after it
+// adds up, and the outcome ends with the last leaf.
+type LeafOutcome struct {
+	Prob   float64
+	Npv    float64
+	Cash   float64
+	End    time.Time
+	Late   bool
+	Broke  bool
+	Leaves []*Ast
+
+	// the number of leading timeline events of each leaf that another
+	// leaf of the outcome already counts
+	skip []int
+}
+
+// riskLevel returns the confidence level of VaR and CVaR.
+func (o Options) riskLevel() float64 {
+	if o.RiskLevel == 0 {
+		return DefaultRiskLevel
+	}
+	return o.RiskLevel
+}
+
+// Distribution returns the leaf outcomes reachable from the node,
+// sorted by NPV, after Backward.
+func (a *Ast) Distribution() []LeafOutcome {
+	return a.dist
+}
+
+// rollUpDist sets the node's distribution from its children's, or to
+// the node itself for a leaf, and computes the risk metrics.
+func (a *Ast) rollUpDist() {
+	a.dist = nil
+	if len(a.Hyperedges) == 0 {
+		a.dist = []LeafOutcome{{Prob: 1, Npv: a.Path.Npv, Cash: a.Path.Cash, End: a.End, Late: a.Late, Broke: a.Broke, Leaves: []*Ast{a}, skip: []int{0}}}
+	}
+	for _, hedge := range a.Hyperedges {
+		for _, o := range jointDist(a, hedge.Children) {
+			o.Prob *= hedge.Prob
+			a.dist = append(a.dist, o)
+		}
+	}
+	sort.SliceStable(a.dist, func(i, j int) bool { return a.dist[i].Npv < a.dist[j].Npv })
+	a.Risk = riskOf(a.dist, a.opts.riskLevel())
+}
+
+// jointDist returns the distribution of the children of one of
+// parent's paths running in parallel: every combination of one
+// outcome of each.  Each child's outcomes include the path up to
+// parent, so it's taken out of all but the first.
+func jointDist(parent *Ast, children []*Ast) (dist []LeafOutcome) {
+	shared := len(parent.Timeline.Events())
+	dist = []LeafOutcome{{Prob: 1}}
+	for i, child := range children {
+		var next []LeafOutcome
+		for _, o := range dist {
+			for _, c := range child.dist {
+				both := LeafOutcome{
+					Prob:   o.Prob * c.Prob,
+					Npv:    o.Npv + c.Npv,
+					Cash:   o.Cash + c.Cash,
+					End:    o.End,
+					Late:   o.Late || c.Late,
+					Broke:  o.Broke || c.Broke,
+					Leaves: append(append([]*Ast{}, o.Leaves...), c.Leaves...),
+					skip:   append([]int{}, o.skip...),
+				}
+				for _, skip := range c.skip {
+					if i > 0 && skip < shared {
+						skip = shared
+					}
+					both.skip = append(both.skip, skip)
+				}
+				if i > 0 {
+					both.Npv -= parent.Path.Npv
+					both.Cash -= parent.Path.Cash
+				}
+				if c.End.After(both.End) {
+					both.End = c.End
+				}
+				next = append(next, both)
+			}
+		}
+		dist = next
+	}
+	return
+}
+
+// riskOf computes the risk metrics of a distribution sorted by NPV.
+func riskOf(dist []LeafOutcome, level float64) (r Risk) {
+	r.Level = level
+	var mean float64
+	for _, o := range dist {
+		mean += o.Prob * o.Npv
+		if o.Npv < 0 {
+			r.PLoss += o.Prob
+		}
+		if o.Late {
+			r.PLate += o.Prob
+		}
+		if o.Broke {
+			r.PBroke += o.Prob
+		}
+	}
+	var variance float64
+	for _, o := range dist {
+		variance += o.Prob * (o.Npv - mean) * (o.Npv - mean)
+	}
+	r.StdevNpv = math.Sqrt(variance)
+
+	// walk up the worst outcomes until the tail is full
+	tail := 1 - level
+	if tail <= 0 || len(dist) == 0 {
+		if len(dist) > 0 {
+			r.VaR = -dist[0].Npv
+			r.CVaR = r.VaR
+		}
+		return
+	}
+	var cum, sum float64
+	for _, o := range dist {
+		p := math.Min(o.Prob, tail-cum)
+		sum += p * o.Npv
+		cum += p
+		if cum >= tail-1e-12 {
+			r.VaR = -o.Npv
+			break
+		}
+	}
+	if cum < tail-1e-12 {
+		r.VaR = -dist[len(dist)-1].Npv
+	}
+	r.CVaR = -sum / cum
+	return
+}
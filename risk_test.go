@@ -0,0 +1,102 @@
+package tree
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestRiskOf(t *testing.T) {
+	dist := []LeafOutcome{
+		{Prob: .02, Npv: -100},
+		{Prob: .08, Npv: -10, Late: true},
+		{Prob: .9, Npv: 50},
+	}
+	r := riskOf(dist, .95)
+	Tassert(t, math.Abs(r.PLoss-.1) < 1e-9, "ploss %v", r.PLoss)
+	Tassert(t, math.Abs(r.PLate-.08) < 1e-9, "plate %v", r.PLate)
+	mean := -2 - .8 + 45.0
+	variance := .02*math.Pow(-100-mean, 2) + .08*math.Pow(-10-mean, 2) + .9*math.Pow(50-mean, 2)
+	Tassert(t, math.Abs(r.StdevNpv-math.Sqrt(variance)) < 1e-9, "stdev %v", r.StdevNpv)
+	// the worst 5%: 2% at -100 and 3% at -10
+	Tassert(t, r.VaR == 10, "var %v", r.VaR)
+	Tassert(t, math.Abs(r.CVaR-(2+.3)/.05) < 1e-9, "cvar %v", r.CVaR)
+}
+
+func TestRisk(t *testing.T) {
+	data, err := testFS.ReadFile("examples/hbr.yaml")
+	Tassert(t, err == nil, "%v", err)
+	roots, err := FromYAML(data)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	// low average demand and high-then-low demand both lose money
+	big := roots[0].Hyperedges[0].Children[0]
+	Tassert(t, big.Name == "big", "got %s", big.Name)
+	Tassert(t, math.Abs(big.Risk.PLoss-.4) < 1e-9, "big ploss %v", big.Risk.PLoss)
+	Tassert(t, big.Risk.StdevNpv > 0, "big stdev %v", big.Risk.StdevNpv)
+	Tassert(t, big.Risk.VaR > 0, "big var %v", big.Risk.VaR)
+	Tassert(t, len(big.Distribution()) == 3, "big outcomes %d", len(big.Distribution()))
+
+	buf, err := ToJSON(roots)
+	Tassert(t, err == nil, "%v", err)
+	var nodes []map[string]interface{}
+	err = json.Unmarshal(buf, &nodes)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, nodes[0]["name"] == "dp1", "json root %v", nodes[0]["name"])
+	Tassert(t, strings.Contains(string(buf), `"pLoss"`), "missing risk in json")
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, !strings.Contains(dot, "p(loss)"), "risk columns by default")
+	RecalcWith(roots, now, testWarn(t), Options{RiskLevel: .9})
+	Tassert(t, big.Risk.Level == .9, "big level %v", big.Risk.Level)
+	dot = string(ToDotWith(roots, testWarn(t), false, Options{ShowRisk: true}))
+	Tassert(t, strings.Contains(dot, "p(loss)"), "missing risk columns in dot")
+	Tassert(t, strings.Contains(dot, "VaR 90%"), "missing risk level in dot")
+}
+
+// jointYAML forks into two paths that run in parallel after the root
+// has spent 100.
+const jointYAML = `
+root:
+  cash: -100
+  days: 30
+  paths:
+    a,b: 1
+a:
+  cash: 60
+  days: 30
+b:
+  cash: 60
+  days: 30
+  paths:
+    good: .5
+    bad: .5
+good:
+  cash: 40
+  days: 30
+bad:
+  cash: -100
+  days: 30
+`
+
+func TestJointRisk(t *testing.T) {
+	roots, err := FromYAML([]byte(jointYAML))
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+	root := roots[0]
+
+	// the root's 100 counts once: -100 + 60 + 60 + 40 or - 100
+	dist := root.Distribution()
+	Tassert(t, len(dist) == 2, "got %d outcomes", len(dist))
+	Tassert(t, dist[0].Npv == -80 && dist[0].Cash == -80 && dist[0].name() == "a+bad", "worst %+v", dist[0])
+	Tassert(t, dist[1].Npv == 60 && dist[1].Cash == 60 && dist[1].name() == "a+good", "best %+v", dist[1])
+	Tassert(t, root.Risk.PLoss == .5, "ploss %v", root.Risk.PLoss)
+	Tassert(t, root.Risk.VaR == 80, "var %v", root.Risk.VaR)
+}
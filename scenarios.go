@@ -0,0 +1,307 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// When the probabilities can't be defended, the alternatives of a
+// decision can still be ranked by treating the leaves under each of
+// them as unweighted scenarios, scored by their path NPV.  The
+// decisions are the nodes with `decision: true`, or the roots if no
+// node is marked.
+//
+// The scenarios are the combinations of the outcomes of the named
+// uncertainties (see Events) found under the decision, so that the
+// same scenario lines up across alternatives in the regret table.  A
+// leaf stands for every scenario its outcome labels allow.  Where a
+// later decision leaves several leaves in the same scenario, the best
+// one is taken; chance branches without labels can't be lined up,
+// and become scenarios of their own, named after their paths.  If
+// there are no labels at all, the only thing the alternatives can
+// share is a single certain outcome each; leaves can't be paired up
+// any other way, so more than one leaf is an error.
+
+// ScenarioAnalysis ranks the alternatives of one decision node.
+type ScenarioAnalysis struct {
+	Decision     string
+	Alpha        float64 // Hurwicz optimism weight
+	Scenarios    []string
+	Alternatives []*Alternative
+
+	// the alternatives chosen by each criterion
+	Maximin       string
+	Maximax       string
+	Hurwicz       string
+	MinimaxRegret string
+}
+
+// Alternative is one path out of a decision node.
+type Alternative struct {
+	Name      string
+	Npv       map[string]float64 // by scenario
+	Regret    map[string]float64 // by scenario
+	Min       float64
+	Max       float64
+	Hurwicz   float64
+	MaxRegret float64
+}
+
+// AnalyzeScenarios ranks the alternatives of each decision in the
+// trees, which must have been through Recalc.  alpha is the Hurwicz
+// weight of the best outcome, between 0 (maximin) and 1 (maximax).
+func AnalyzeScenarios(roots []*Ast, alpha float64) (analyses []*ScenarioAnalysis, err error) {
+	if alpha < 0 || alpha > 1 {
+		return nil, fmt.Errorf("alpha must be between 0 and 1: %v", alpha)
+	}
+	for _, node := range decisionNodes(roots) {
+		if len(node.Hyperedges) == 0 {
+			continue
+		}
+		var sa *ScenarioAnalysis
+		sa, err = analyzeDecision(node, alpha)
+		if err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, sa)
+	}
+	return
+}
+
+// analyzeDecision ranks the alternatives of one decision node.
+func analyzeDecision(node *Ast, alpha float64) (sa *ScenarioAnalysis, err error) {
+	sa = &ScenarioAnalysis{Decision: node.Name, Alpha: alpha}
+	leaves := make([][]scenarioLeaf, len(node.Hyperedges))
+	for i, hedge := range node.Hyperedges {
+		for _, child := range hedge.Children {
+			leaves[i] = append(leaves[i], scenarioLeaves(child, hedge.Outcomes, nil)...)
+		}
+	}
+	states := scenarioStates(leaves)
+
+	seen := make(map[string]bool)
+	for i, hedge := range node.Hyperedges {
+		alt := &Alternative{
+			Name:   hedge.Path,
+			Npv:    make(map[string]float64),
+			Regret: make(map[string]float64),
+		}
+		if len(states) == 1 && len(states[0]) == 0 {
+			// nothing to line up by
+			if len(leaves[i]) > 1 {
+				return nil, fmt.Errorf("%s: %s has %d leaves and no outcome labels to line them up with the other alternatives; use shared uncertainties",
+					node.Name, hedge.Path, len(leaves[i]))
+			}
+			for _, leaf := range leaves[i] {
+				alt.Npv["certain"] = leaf.npv
+			}
+		}
+		for _, state := range states {
+			if len(state) == 0 {
+				break
+			}
+			for _, leaf := range leaves[i] {
+				if !leaf.allows(state) {
+					continue
+				}
+				scenario := stateName(state, leaf.via)
+				npv, ok := alt.Npv[scenario]
+				if !ok || leaf.npv > npv {
+					alt.Npv[scenario] = leaf.npv
+				}
+			}
+		}
+		if len(alt.Npv) == 0 {
+			return nil, fmt.Errorf("%s: %s has no scenarios", node.Name, hedge.Path)
+		}
+		alt.Min = math.Inf(1)
+		alt.Max = math.Inf(-1)
+		for scenario, npv := range alt.Npv {
+			alt.Min = math.Min(alt.Min, npv)
+			alt.Max = math.Max(alt.Max, npv)
+			if !seen[scenario] {
+				seen[scenario] = true
+				sa.Scenarios = append(sa.Scenarios, scenario)
+			}
+		}
+		alt.Hurwicz = alpha*alt.Max + (1-alpha)*alt.Min
+		sa.Alternatives = append(sa.Alternatives, alt)
+	}
+	sort.Strings(sa.Scenarios)
+
+	// regret is the shortfall from the best alternative in the
+	// same scenario
+	for _, scenario := range sa.Scenarios {
+		best := math.Inf(-1)
+		for _, alt := range sa.Alternatives {
+			if npv, ok := alt.Npv[scenario]; ok {
+				best = math.Max(best, npv)
+			}
+		}
+		for _, alt := range sa.Alternatives {
+			if npv, ok := alt.Npv[scenario]; ok {
+				alt.Regret[scenario] = best - npv
+				alt.MaxRegret = math.Max(alt.MaxRegret, best-npv)
+			}
+		}
+	}
+
+	pick := func(score func(alt *Alternative) float64) (name string) {
+		best := math.Inf(-1)
+		for _, alt := range sa.Alternatives {
+			if s := score(alt); s > best {
+				best = s
+				name = alt.Name
+			}
+		}
+		return
+	}
+	sa.Maximin = pick(func(alt *Alternative) float64 { return alt.Min })
+	sa.Maximax = pick(func(alt *Alternative) float64 { return alt.Max })
+	sa.Hurwicz = pick(func(alt *Alternative) float64 { return alt.Hurwicz })
+	sa.MinimaxRegret = pick(func(alt *Alternative) float64 { return -alt.MaxRegret })
+	return
+}
+
+// scenarioLeaf is a leaf with the outcomes that lead to it.
+type scenarioLeaf struct {
+	outcomes map[string]map[string]bool // uncertainty -> allowed outcomes
+	via      []string                   // unlabeled chance paths
+	npv      float64
+}
+
+// allows reports whether the leaf is reachable in state, which maps
+// each uncertainty to one outcome.
+func (leaf scenarioLeaf) allows(state map[string]string) bool {
+	for u, allowed := range leaf.outcomes {
+		if !allowed[state[u]] {
+			return false
+		}
+	}
+	return true
+}
+
+// scenarioLeaves returns the leaves under node.
+func scenarioLeaves(node *Ast, outcomes map[string]string, via []string) (leaves []scenarioLeaf) {
+	if len(node.Hyperedges) == 0 {
+		leaf := scenarioLeaf{outcomes: make(map[string]map[string]bool), via: via, npv: node.Path.Npv}
+		for u, o := range outcomes {
+			leaf.outcomes[u] = make(map[string]bool)
+			for _, one := range strings.Split(o, "|") {
+				leaf.outcomes[u][one] = true
+			}
+		}
+		return []scenarioLeaf{leaf}
+	}
+	for _, hedge := range node.Hyperedges {
+		merged := make(map[string]string, len(outcomes)+len(hedge.Outcomes))
+		for u, o := range outcomes {
+			merged[u] = o
+		}
+		for u, o := range hedge.Outcomes {
+			merged[u] = o
+		}
+		branch := via
+		if !node.Decision && len(hedge.Outcomes) == 0 && len(node.Hyperedges) > 1 {
+			branch = append(append([]string(nil), via...), hedge.Path)
+		}
+		for _, child := range hedge.Children {
+			leaves = append(leaves, scenarioLeaves(child, merged, branch)...)
+		}
+	}
+	return
+}
+
+// scenarioStates returns every combination of the outcomes found in
+// the leaves' labels.
+func scenarioStates(leaves [][]scenarioLeaf) (states []map[string]string) {
+	all := make(map[string]map[string]bool)
+	for _, alt := range leaves {
+		for _, leaf := range alt {
+			for u, allowed := range leaf.outcomes {
+				if all[u] == nil {
+					all[u] = make(map[string]bool)
+				}
+				for o := range allowed {
+					all[u][o] = true
+				}
+			}
+		}
+	}
+	states = []map[string]string{{}}
+	var names []string
+	for u := range all {
+		names = append(names, u)
+	}
+	sort.Strings(names)
+	for _, u := range names {
+		var outcomes []string
+		for o := range all[u] {
+			outcomes = append(outcomes, o)
+		}
+		sort.Strings(outcomes)
+		var next []map[string]string
+		for _, state := range states {
+			for _, o := range outcomes {
+				s := map[string]string{u: o}
+				for k, v := range state {
+					s[k] = v
+				}
+				next = append(next, s)
+			}
+		}
+		states = next
+	}
+	return
+}
+
+// stateName names the scenario for a state and unlabeled paths.
+func stateName(state map[string]string, via []string) string {
+	var parts []string
+	for u, o := range state {
+		parts = append(parts, u+"="+o)
+	}
+	sort.Strings(parts)
+	parts = append(parts, via...)
+	return strings.Join(parts, ", ")
+}
+
+// String formats the analysis as a summary and a regret table.
+func (sa *ScenarioAnalysis) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "decision: %s\n\n", sa.Decision)
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "alternative\tmin npv\tmax npv\thurwicz(%.2f)\tmax regret\t\n", sa.Alpha)
+	for _, alt := range sa.Alternatives {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", alt.Name, form(alt.Min), form(alt.Max), form(alt.Hurwicz), form(alt.MaxRegret))
+	}
+	tw.Flush()
+	fmt.Fprintf(&buf, "\nmaximin: %s\nmaximax: %s\nhurwicz: %s\nminimax regret: %s\n",
+		sa.Maximin, sa.Maximax, sa.Hurwicz, sa.MinimaxRegret)
+
+	fmt.Fprintf(&buf, "\nregret:\n\n")
+	tw = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "scenario\t")
+	for _, alt := range sa.Alternatives {
+		fmt.Fprintf(tw, "%s\t", alt.Name)
+	}
+	fmt.Fprintln(tw)
+	for _, scenario := range sa.Scenarios {
+		fmt.Fprintf(tw, "%s\t", scenario)
+		for _, alt := range sa.Alternatives {
+			regret, ok := alt.Regret[scenario]
+			if ok {
+				fmt.Fprintf(tw, "%s\t", form(regret))
+			} else {
+				fmt.Fprint(tw, "-\t")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	return buf.String()
+}
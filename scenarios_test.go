@@ -0,0 +1,101 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestAnalyzeScenarios(t *testing.T) {
+	buf := []byte(`
+uncertainties:
+  demand: {high: .5, low: .5}
+choose:
+  decision: true
+  paths:
+    big: .5
+    small: .5
+big:
+  cash: -10
+  paths:
+    big-high: demand.high
+    big-low: demand.low
+big-high:
+  cash: 100
+big-low:
+  cash: -50
+small:
+  cash: -5
+  paths:
+    small-high: demand.high
+    small-low: demand.low
+small-high:
+  cash: 40
+small-low:
+  cash: 10
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	analyses, err := AnalyzeScenarios(roots, 0.5)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, len(analyses) == 1, "analyses %d", len(analyses))
+	sa := analyses[0]
+	Tassert(t, strings.Join(sa.Scenarios, ";") == "demand=high;demand=low", "scenarios %v", sa.Scenarios)
+	big, small := sa.Alternatives[0], sa.Alternatives[1]
+	Tassert(t, big.Min == -60 && big.Max == 90, "big min %v max %v", big.Min, big.Max)
+	Tassert(t, small.Min == 5 && small.Max == 35, "small min %v max %v", small.Min, small.Max)
+	Tassert(t, big.Hurwicz == 15 && small.Hurwicz == 20, "hurwicz %v %v", big.Hurwicz, small.Hurwicz)
+	Tassert(t, big.Regret["demand=low"] == 65 && small.Regret["demand=high"] == 55, "regret %v %v", big.Regret, small.Regret)
+	Tassert(t, sa.Maximin == "small" && sa.Maximax == "big", "maximin %s maximax %s", sa.Maximin, sa.Maximax)
+	Tassert(t, sa.Hurwicz == "small" && sa.MinimaxRegret == "small", "hurwicz %s minimax regret %s", sa.Hurwicz, sa.MinimaxRegret)
+
+	analyses, err = AnalyzeScenarios(roots, 0.9)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, analyses[0].Hurwicz == "big", "hurwicz(0.9) %s", analyses[0].Hurwicz)
+	Tassert(t, strings.Contains(analyses[0].String(), "minimax regret: small"), "%s", analyses[0])
+
+	_, err = AnalyzeScenarios(roots, 2)
+	Tassert(t, err != nil, "expected alpha error")
+}
+
+func TestScenariosWithoutLabels(t *testing.T) {
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// certain alternatives share the one scenario
+	roots, err := FromYAML([]byte("choose:\n  paths:\n    a: .5\n    b: .5\na:\n  cash: 10\nb:\n  cash: 30\n"))
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, now, testWarn(t))
+	analyses, err := AnalyzeScenarios(roots, 0.5)
+	Tassert(t, err == nil, "%v", err)
+	sa := analyses[0]
+	Tassert(t, strings.Join(sa.Scenarios, ";") == "certain", "scenarios %v", sa.Scenarios)
+	Tassert(t, sa.Alternatives[0].MaxRegret == 20 && sa.MinimaxRegret == "b", "regret %v, chose %s", sa.Alternatives[0].MaxRegret, sa.MinimaxRegret)
+
+	// leaves without labels can't be paired up
+	buf := []byte(`
+choose:
+  paths:
+    a: .5
+    b: .5
+a:
+  paths:
+    a1: .5
+    a2: .5
+a1:
+  cash: 10
+a2:
+  cash: 20
+b:
+  cash: 30
+`)
+	roots, err = FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	Recalc(roots, now, testWarn(t))
+	_, err = AnalyzeScenarios(roots, 0.5)
+	Tassert(t, err != nil && strings.Contains(err.Error(), "choose: a has 2 leaves and no outcome labels"), "got %v", err)
+}
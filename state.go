@@ -0,0 +1,130 @@
+package tree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// State variables are declared with their initial values in the
+// model-level `state:` section.  A node can change them with `set:`,
+// and node expressions, path probabilities and `when:` guards can
+// read them, so a shared subtree can behave differently depending on
+// how it was reached:
+//
+//	state:
+//	  inventory: 0
+//	restock:
+//	  set:
+//	    inventory: inventory + 100
+//	  paths:
+//	    sell: 1
+//	sell:
+//	  when: inventory > 50
+//	  cash: inventory * 20
+
+// resolveState evaluates the initial state values.
+func (m *Model) resolveState() (err error) {
+	m.state = make(Vars)
+	for name, expr := range m.State {
+		if !identRe.MatchString(name) {
+			return fmt.Errorf("state: invalid name: %q", name)
+		}
+		if _, ok := m.vars[name]; ok {
+			return fmt.Errorf("state: %s is already a param", name)
+		}
+		m.state[name], err = evalRat(expandAmount(expr), m.vars)
+		if err != nil {
+			return fmt.Errorf("state: %s: %q: %v", name, expr, err)
+		}
+	}
+	m.dynamic = len(m.State) > 0
+	for _, node := range m.nodes {
+		if node.When != "" {
+			m.dynamic = true
+		}
+	}
+	return
+}
+
+// stateful returns true if paths can differ depending on how a node
+// was reached.
+func (m *Model) stateful() bool {
+	return m != nil && m.dynamic
+}
+
+// applySet returns a copy of state with the node's `set:` expressions
+// applied.  All expressions see the state as it was on arrival.
+func (a *Ast) applySet(vars, state Vars) (out Vars, err error) {
+	if len(a.src.Set) == 0 {
+		return state, nil
+	}
+	var names []string
+	for name := range a.src.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out = state.With(nil)
+	for _, name := range names {
+		if _, ok := state[name]; !ok {
+			return nil, fmt.Errorf("set: undeclared state variable: %s", name)
+		}
+		expr := a.src.Set[name]
+		out[name], err = evalRat(expandAmount(expr), vars)
+		if err != nil {
+			return nil, fmt.Errorf("set: %s: %q: %v", name, expr, err)
+		}
+	}
+	return
+}
+
+// choosePaths drops the hyperedges whose children have a false
+// `when:` guard and re-evaluates the path probabilities with the
+// node's state.  A `rest` path takes up the probability of dropped
+// paths.
+func (a *Ast) choosePaths() (err error) {
+	vars := a.vars.With(a.State)
+	enabled := make(Paths)
+	var hedges []*Hyperedge
+	for _, hedge := range a.Hyperedges {
+		ok := true
+		for _, child := range hedge.Children {
+			if child.src.When == "" {
+				continue
+			}
+			var guard float64
+			guard, err = evalFloat(child.src.When, vars)
+			if err != nil {
+				return fmt.Errorf("%s: when: %v", child.Name, err)
+			}
+			if guard == 0 {
+				ok = false
+			}
+		}
+		if ok {
+			enabled[hedge.Path] = a.src.Paths[hedge.Path]
+			hedges = append(hedges, hedge)
+		}
+	}
+	probs, err := enabled.Probs(vars)
+	if err != nil {
+		return fmt.Errorf("paths: %v", err)
+	}
+	for _, hedge := range hedges {
+		hedge.Prob = probs[hedge.Path]
+	}
+	a.Hyperedges = hedges
+	return
+}
+
+// setLabel describes the state variables set by the node, e.g.
+// `inventory=100`.
+func (a *Ast) setLabel() string {
+	var parts []string
+	for name := range a.src.Set {
+		val, _ := a.State[name].Float64()
+		parts = append(parts, fmt.Sprintf("%s=%g", name, val))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
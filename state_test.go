@@ -0,0 +1,68 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestState(t *testing.T) {
+	buf := []byte(`
+params:
+  price: 20
+state:
+  inventory: 0
+start:
+  paths:
+    restock: 0.5
+    sell: 0.5
+restock:
+  set:
+    inventory: inventory + 100
+  paths:
+    sell: 1
+sell:
+  cash: inventory * price
+  days: 30
+  paths:
+    reorder: inventory / 200
+    idle: rest
+reorder:
+  when: inventory > 50
+  cash: -1000
+idle:
+  cash: 0
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	start := roots[0]
+	restock := start.Hyperedges[0].Children[0]
+	Tassert(t, restock.Name == "restock", "got %s", restock.Name)
+	inv, _ := restock.State["inventory"].Float64()
+	Tassert(t, inv == 100, "inventory %v", inv)
+
+	// reached via restock: sells 100 units, may reorder
+	sell1 := restock.Hyperedges[0].Children[0]
+	Tassert(t, sell1.Node.Cash == 2000, "sell1 cash %v", sell1.Node.Cash)
+	Tassert(t, len(sell1.Hyperedges) == 2, "sell1 paths %d", len(sell1.Hyperedges))
+	Tassert(t, sell1.Hyperedges[1].Children[0].Name == "reorder", "sell1 path %s", sell1.Hyperedges[1].Path)
+	Tassert(t, sell1.Hyperedges[1].Prob == 0.5, "reorder prob %v", sell1.Hyperedges[1].Prob)
+
+	// reached directly: nothing to sell, reorder guard is false
+	sell2 := start.Hyperedges[1].Children[0]
+	Tassert(t, sell2.Node.Cash == 0, "sell2 cash %v", sell2.Node.Cash)
+	Tassert(t, len(sell2.Hyperedges) == 1, "sell2 paths %d", len(sell2.Hyperedges))
+	Tassert(t, sell2.Hyperedges[0].Path == "idle", "sell2 path %s", sell2.Hyperedges[0].Path)
+	Tassert(t, sell2.Hyperedges[0].Prob == 1, "idle prob %v", sell2.Hyperedges[0].Prob)
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, "set: inventory=100"), "missing set label in dot")
+
+	_, err = FromYAML([]byte("params:\n  x: 1\nstate:\n  x: 0\na:\n  cash: 1\n"))
+	Tassert(t, err != nil, "expected error for state shadowing a param")
+}
@@ -0,0 +1,296 @@
+package tree
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// A submodel is a reusable, parameterized subtree.  It is defined in
+// the model-level `submodels:` section and instantiated by a node
+// with `use:`:
+//
+//	submodels:
+//	  stagegate:
+//	    args:
+//	      cost: 1M
+//	      p: 0.5
+//	    exits: [launch]
+//	    nodes:
+//	      design:
+//	        cash: -cost * 0.2
+//	        days: 90
+//	        paths:
+//	          launch: p
+//	          kill: rest
+//	      launch:
+//	        cash: -cost
+//	        days: 180
+//	      kill:
+//	        desc: project killed
+//	widget:
+//	  use: stagegate(cost=2M, p=0.4)
+//	  paths:
+//	    market: 1
+//
+// The instance node takes the place of the submodel's entry node (its
+// only root unless `entry:` says otherwise), and the other nodes are
+// copied under the instance's name, e.g. `widget/launch`.  Fields set
+// on the instance node override the entry node's.  The args become
+// node-local vars of every copied node; args without a default must
+// be given.  The instance's own `paths:` are added to the submodel's
+// `exits:` nodes.
+type Submodel struct {
+	Args  map[string]string `yaml:",omitempty"`
+	Entry string            `yaml:",omitempty"`
+	Exits []string          `yaml:",omitempty"`
+	Nodes Nodes
+}
+
+var useRe = regexp.MustCompile(`^\s*([A-Za-z_][\w/-]*)\s*(?:\((.*)\))?\s*$`)
+
+// maxNesting limits submodel expansion, to catch a submodel that uses
+// itself.
+const maxNesting = 100
+
+// expandSubmodels replaces each working node that has `use:` with a
+// copy of the submodel.  Submodels can use other submodels.
+func (m *Model) expandSubmodels() (err error) {
+	for depth := 0; ; depth++ {
+		var names []string
+		for name, node := range m.nodes {
+			if node.Use != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return
+		}
+		if depth >= maxNesting {
+			return fmt.Errorf("use: submodels nested too deeply: %s", strings.Join(names, ", "))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			err = m.instantiate(name)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// instantiate expands the instance node with the given name.
+func (m *Model) instantiate(name string) (err error) {
+	inst := m.nodes[name]
+	subName, args, err := parseUse(inst.Use)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	sub, ok := m.Submodels[subName]
+	if !ok {
+		return fmt.Errorf("%s: use: no such submodel: %s", name, subName)
+	}
+
+	// bind args, falling back to the defaults
+	vars := make(map[string]string)
+	for arg, expr := range args {
+		if _, ok := sub.Args[arg]; !ok {
+			return fmt.Errorf("%s: use: %s has no arg %s", name, subName, arg)
+		}
+		vars[arg] = expr
+	}
+	for arg, def := range sub.Args {
+		if _, ok := vars[arg]; ok {
+			continue
+		}
+		if strings.TrimSpace(def) == "" {
+			return fmt.Errorf("%s: use: missing arg %s for %s", name, arg, subName)
+		}
+		vars[arg] = def
+	}
+
+	entry, err := sub.entry(subName)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	rename := make(map[string]string)
+	for inner := range sub.Nodes {
+		if inner == entry {
+			rename[inner] = name
+		} else {
+			rename[inner] = name + "/" + inner
+		}
+	}
+	exits := make(map[string]bool)
+	for _, exit := range sub.Exits {
+		if _, ok := sub.Nodes[exit]; !ok {
+			return fmt.Errorf("%s: use: %s: no such exit node: %s", name, subName, exit)
+		}
+		exits[exit] = true
+	}
+
+	cont := inst.Paths
+	inst.Paths = nil
+	inst.Use = ""
+	inst.unset("paths", "use")
+	for inner, node := range sub.Nodes {
+		node = renameNode(node, rename)
+		local := make(map[string]string)
+		for k, v := range vars {
+			local[k] = v
+		}
+		for k, v := range node.Vars {
+			local[k] = v
+		}
+		node.Vars = local
+		if exits[inner] && len(cont) > 0 {
+			paths := make(Paths)
+			for k, v := range node.Paths {
+				paths[k] = v
+			}
+			for k, v := range cont {
+				paths[k] = v
+			}
+			node.Paths = paths
+		}
+		newName := rename[inner]
+		if inner == entry {
+			for k, v := range inst.Vars {
+				local[k] = v
+			}
+			node = mergeNode(inst, node)
+			node.Vars = local
+		} else if _, ok := m.nodes[newName]; ok {
+			return fmt.Errorf("%s: use: %s collides with an existing node", name, newName)
+		}
+		m.nodes[newName] = node
+	}
+	return
+}
+
+// entry returns the name of the submodel's entry node.
+func (sub Submodel) entry(subName string) (entry string, err error) {
+	if sub.Entry != "" {
+		if _, ok := sub.Nodes[sub.Entry]; !ok {
+			err = fmt.Errorf("use: %s: no such entry node: %s", subName, sub.Entry)
+		}
+		return sub.Entry, err
+	}
+	var roots []string
+	for root := range sub.Nodes.RootNodes() {
+		roots = append(roots, root)
+	}
+	if len(roots) != 1 {
+		sort.Strings(roots)
+		err = fmt.Errorf("use: %s: need exactly one root node or an entry, got %v", subName, roots)
+		return
+	}
+	return roots[0], nil
+}
+
+// parseUse parses `name(arg=expr, ...)`.
+func parseUse(use string) (name string, args map[string]string, err error) {
+	m := useRe.FindStringSubmatch(use)
+	if m == nil {
+		err = fmt.Errorf("use: invalid syntax: %q", use)
+		return
+	}
+	name = m[1]
+	args = make(map[string]string)
+	if strings.TrimSpace(m[2]) == "" {
+		return
+	}
+	for _, part := range splitTop(m[2], ',') {
+		kv := strings.SplitN(part, "=", 2)
+		arg := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || !identRe.MatchString(arg) {
+			err = fmt.Errorf("use: invalid arg: %q", part)
+			return
+		}
+		args[arg] = strings.TrimSpace(kv[1])
+	}
+	return
+}
+
+// splitTop splits s on sep, ignoring separators inside parentheses.
+func splitTop(s string, sep rune) (parts []string) {
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + len(string(sep))
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+	return
+}
+
+// renameNode returns a copy of node with the node names it mentions
+// -- path keys, prereqs, extends, onFail and cross-node references,
+// including those in `each:` -- mapped through rename.
+func renameNode(node Node, rename map[string]string) Node {
+	renameList := func(list string) string {
+		names := strings.Split(list, ",")
+		for i, n := range names {
+			if to, ok := rename[n]; ok {
+				names[i] = to
+			}
+		}
+		return strings.Join(names, ",")
+	}
+	if to, ok := rename[node.Extends]; ok {
+		node.Extends = to
+	}
+	if to, ok := rename[node.OnFail]; ok {
+		node.OnFail = to
+	}
+	if node.Each != nil {
+		each := renameNode(*node.Each, rename)
+		node.Each = &each
+	}
+	if node.Paths != nil {
+		paths := make(Paths)
+		for k, v := range node.Paths {
+			paths[renameList(k)] = v
+		}
+		node.Paths = paths
+	}
+	var prereqs []string
+	for _, p := range node.Prereqs {
+		prereqs = append(prereqs, renameList(p))
+	}
+	node.Prereqs = prereqs
+
+	// cross-node references, longest names first
+	var names []string
+	for n := range rename {
+		names = append(names, regexp.QuoteMeta(n))
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	re := regexp.MustCompile(Spf(`(^|[^\w.])(%s)\.(%s)\b`, strings.Join(names, "|"), strings.Join(refFields, "|")))
+	ref := func(expr string) string {
+		return re.ReplaceAllStringFunc(expr, func(s string) string {
+			m := re.FindStringSubmatch(s)
+			return m[1] + rename[m[2]] + "." + m[3]
+		})
+	}
+	node.Cash = ref(node.Cash)
+	node.Days = ref(node.Days)
+	node.Workdays = ref(node.Workdays)
+	node.Repeat = ref(node.Repeat)
+	node.When = ref(node.When)
+	node.Paths = rewriteMap(node.Paths, ref)
+	node.Set = rewriteMap(node.Set, ref)
+	return node
+}
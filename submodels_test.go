@@ -0,0 +1,93 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSubmodels(t *testing.T) {
+	buf := []byte(`
+submodels:
+  stagegate:
+    args:
+      cost: 1M
+      p: 0.5
+    exits: [launch]
+    nodes:
+      design:
+        cash: -cost * 0.2
+        days: 90
+        paths:
+          launch: p
+          kill: rest
+      launch:
+        cash: -cost
+        days: design.days * 2
+      kill:
+        desc: project killed
+portfolio:
+  paths:
+    widget,gadget: 1
+widget:
+  use: stagegate(cost=2M, p=0.4)
+  desc: widget project
+  paths:
+    market: 1
+gadget:
+  use: stagegate(p=max(0.1, 0.3))
+market:
+  cash: 5M
+  days: 365
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	Tassert(t, len(roots) == 1, "roots %d", len(roots))
+	now := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	Recalc(roots, now, testWarn(t))
+
+	hedge := roots[0].Hyperedges[0]
+	widget, gadget := hedge.Children[0], hedge.Children[1]
+	Tassert(t, widget.Name == "widget" && widget.Desc == "widget project", "widget %s %q", widget.Name, widget.Desc)
+	Tassert(t, widget.Node.Cash == -400000, "widget cash %v", widget.Node.Cash)
+	Tassert(t, widget.Hyperedges[0].Path == "widget/kill", "widget path %s", widget.Hyperedges[0].Path)
+	Tassert(t, widget.Hyperedges[1].Prob == 0.4, "widget launch prob %v", widget.Hyperedges[1].Prob)
+	launch := widget.Hyperedges[1].Children[0]
+	Tassert(t, launch.Name == "widget/launch", "launch name %s", launch.Name)
+	Tassert(t, launch.Node.Cash == -2e6, "launch cash %v", launch.Node.Cash)
+	Tassert(t, launch.Node.Duration == 180*24*time.Hour, "launch duration %v", launch.Node.Duration)
+	Tassert(t, launch.Hyperedges[0].Children[0].Name == "market", "launch continues to %s", launch.Hyperedges[0].Path)
+	kill := widget.Hyperedges[0].Children[0]
+	Tassert(t, len(kill.Hyperedges) == 0, "kill is not an exit")
+
+	Tassert(t, gadget.Node.Cash == -200000, "gadget cash %v", gadget.Node.Cash)
+	Tassert(t, gadget.Hyperedges[1].Prob == 0.3, "gadget launch prob %v", gadget.Hyperedges[1].Prob)
+	Tassert(t, len(gadget.Hyperedges[1].Children[0].Hyperedges) == 0, "gadget has no continuation")
+
+	dot := string(ToDot(roots, testWarn(t), false))
+	Tassert(t, strings.Contains(dot, "widget/launch_1"), "missing namespaced node in dot")
+}
+
+func TestSubmodelErrors(t *testing.T) {
+	sub := `
+submodels:
+  s:
+    args:
+      x:
+    nodes:
+      a:
+        cash: x
+`
+	cases := map[string]string{
+		"foo:\n  use: s(x=1, y=2)\n": "has no arg y",
+		"foo:\n  use: s\n":           "missing arg x",
+		"foo:\n  use: nope(x=1)\n":   "no such submodel",
+		"foo:\n  use: s(x)\n":        "invalid arg",
+	}
+	for yml, want := range cases {
+		_, err := FromYAML([]byte(sub + yml))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: want %q, got %v", yml, want, err)
+	}
+}
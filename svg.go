@@ -0,0 +1,95 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+)
+
+// svgSeries is one line of an svgChart.  A step series holds each y
+// until the next x, like a cumulative distribution.
+type svgSeries struct {
+	Name   string
+	X, Y   []float64
+	Step   bool
+	Dashed bool
+}
+
+var svgColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+const (
+	svgWidth  = 800
+	svgHeight = 500
+	svgLeft   = 90
+	svgRight  = 200
+	svgTop    = 40
+	svgBottom = 60
+)
+
+// svgChart draws the series as a line chart.  xfmt and yfmt format
+// the tick labels.
+func svgChart(title, xlabel, ylabel string, series []svgSeries, xfmt, yfmt func(float64) string) []byte {
+	xlo, xhi := math.Inf(1), math.Inf(-1)
+	ylo, yhi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for i := range s.X {
+			xlo, xhi = math.Min(xlo, s.X[i]), math.Max(xhi, s.X[i])
+			ylo, yhi = math.Min(ylo, s.Y[i]), math.Max(yhi, s.Y[i])
+		}
+	}
+	if math.IsInf(xlo, 0) {
+		xlo, xhi, ylo, yhi = 0, 1, 0, 1
+	}
+	if xhi == xlo {
+		xlo, xhi = xlo-1, xhi+1
+	}
+	if yhi == ylo {
+		ylo, yhi = ylo-1, yhi+1
+	}
+	plotW := float64(svgWidth - svgLeft - svgRight)
+	plotH := float64(svgHeight - svgTop - svgBottom)
+	px := func(x float64) float64 { return svgLeft + (x-xlo)/(xhi-xlo)*plotW }
+	py := func(y float64) float64 { return svgTop + (yhi-y)/(yhi-ylo)*plotH }
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", svgWidth, svgHeight)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(&buf, `<text x="%d" y="20" font-size="16">%s</text>`+"\n", svgLeft, html.EscapeString(title))
+
+	// axes and ticks
+	fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%.0f" height="%.0f" fill="none" stroke="black"/>`+"\n", svgLeft, svgTop, plotW, plotH)
+	const ticks = 5
+	for i := 0; i <= ticks; i++ {
+		x := xlo + (xhi-xlo)*float64(i)/ticks
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#ddd"/>`+"\n", px(x), svgTop, px(x), svgHeight-svgBottom)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", px(x), svgHeight-svgBottom+18, html.EscapeString(xfmt(x)))
+		y := ylo + (yhi-ylo)*float64(i)/ticks
+		fmt.Fprintf(&buf, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n", svgLeft, py(y), svgWidth-svgRight, py(y))
+		fmt.Fprintf(&buf, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n", svgLeft-6, py(y)+4, html.EscapeString(yfmt(y)))
+	}
+	fmt.Fprintf(&buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", svgLeft+plotW/2, svgHeight-15, html.EscapeString(xlabel))
+	fmt.Fprintf(&buf, `<text x="20" y="%.1f" text-anchor="middle" transform="rotate(-90 20 %.1f)">%s</text>`+"\n", svgTop+plotH/2, svgTop+plotH/2, html.EscapeString(ylabel))
+
+	// lines and legend
+	for i, s := range series {
+		color := svgColors[i%len(svgColors)]
+		var points bytes.Buffer
+		for j := range s.X {
+			if s.Step && j > 0 {
+				fmt.Fprintf(&points, "%.1f,%.1f ", px(s.X[j]), py(s.Y[j-1]))
+			}
+			fmt.Fprintf(&points, "%.1f,%.1f ", px(s.X[j]), py(s.Y[j]))
+		}
+		dash := ""
+		if s.Dashed {
+			dash = ` stroke-dasharray="6,4"`
+		}
+		fmt.Fprintf(&buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"%s/>`+"\n", bytes.TrimSpace(points.Bytes()), color, dash)
+		ly := svgTop + 10 + 18*i
+		fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"%s/>`+"\n", svgWidth-svgRight+10, ly, svgWidth-svgRight+30, ly, color, dash)
+		fmt.Fprintf(&buf, `<text x="%d" y="%d">%s</text>`+"\n", svgWidth-svgRight+36, ly+4, html.EscapeString(s.Name))
+	}
+	fmt.Fprintln(&buf, "</svg>")
+	return buf.Bytes()
+}
@@ -0,0 +1,137 @@
+package tree
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A node with `extends: name` inherits every field it doesn't set
+// itself from the named template (or, if there is no such template,
+// from the named node).  Templates live in the model-level
+// `templates:` section, aren't part of any tree, and can extend other
+// templates:
+//
+//	templates:
+//	  renewal:
+//	    desc: annual license renewal
+//	    cash: -12k
+//	    days: 365
+//	    repeat: 3
+//	crm:
+//	  extends: renewal
+//	  cash: -20k
+//
+// A field given on the node wins even if it is zero, e.g. `finrate: 0`
+// or `decision: false`.
+
+// applyTemplates replaces each working node with its expanded form.
+func (m *Model) applyTemplates() (err error) {
+	var names []string
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		node := m.nodes[name]
+		if node.Extends == "" {
+			continue
+		}
+		node, err = m.inherit(node, []string{name})
+		if err != nil {
+			return
+		}
+		m.nodes[name] = node
+	}
+	return
+}
+
+// inherit returns node with the unset fields filled in from its base,
+// recursively.  The stack holds the names seen so far, to catch
+// cycles.
+func (m *Model) inherit(node Node, stack []string) (out Node, err error) {
+	out = node
+	baseName := node.Extends
+	if baseName == "" {
+		return
+	}
+	for _, name := range stack {
+		if name == baseName {
+			err = fmt.Errorf("extends: cycle: %s -> %s", strings.Join(stack, " -> "), baseName)
+			return
+		}
+	}
+	base, ok := m.Templates[baseName]
+	if !ok {
+		base, ok = m.nodes[baseName]
+	}
+	if !ok {
+		err = fmt.Errorf("%s: extends: no such template or node: %s", stack[len(stack)-1], baseName)
+		return
+	}
+	base, err = m.inherit(base, append(stack, baseName))
+	if err != nil {
+		return
+	}
+	out = mergeNode(node, base)
+	out.Extends = ""
+	return
+}
+
+// UnmarshalYAML reads a node and records which keys it gives.
+func (node *Node) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	type plain Node
+	err = unmarshal((*plain)(node))
+	if err != nil {
+		return
+	}
+	var keys map[string]interface{}
+	err = unmarshal(&keys)
+	if err != nil {
+		return
+	}
+	node.set = make(map[string]bool)
+	for key := range keys {
+		node.set[key] = true
+	}
+	return
+}
+
+// unset forgets that the keys were given, after their fields have
+// been cleared.
+func (node *Node) unset(keys ...string) {
+	set := make(map[string]bool)
+	for key := range node.set {
+		set[key] = true
+	}
+	for _, key := range keys {
+		delete(set, key)
+	}
+	node.set = set
+}
+
+// yamlKey returns the YAML key of a Node field.
+func yamlKey(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// mergeNode returns node with each field it doesn't give copied from
+// base.  Fields that are given on node, including maps, win as a
+// whole.  For nodes that weren't read from YAML, a zero-valued field
+// counts as not given.
+func mergeNode(node, base Node) Node {
+	nv := reflect.ValueOf(&node).Elem()
+	bv := reflect.ValueOf(base)
+	for i := 0; i < nv.NumField(); i++ {
+		f := nv.Field(i)
+		if f.CanSet() && f.IsZero() && !node.set[yamlKey(nv.Type().Field(i))] {
+			f.Set(bv.Field(i))
+		}
+	}
+	return node
+}
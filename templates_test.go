@@ -0,0 +1,79 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestTemplates(t *testing.T) {
+	buf := []byte(`
+templates:
+  annual:
+    days: 365
+    finrate: .08
+  renewal:
+    extends: annual
+    desc: annual license renewal
+    cash: -12k
+    repeat: 3
+licenses:
+  paths:
+    crm,erp: 1
+crm:
+  extends: renewal
+  cash: -20k
+erp:
+  extends: renewal
+  desc: erp renewal
+  repeat: 5
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	hedge := roots[0].Hyperedges[0]
+	crm, erp := hedge.Children[0], hedge.Children[1]
+	Tassert(t, crm.Desc == "annual license renewal", "crm desc %q", crm.Desc)
+	Tassert(t, crm.Period.Cash == -20000, "crm cash %v", crm.Period.Cash)
+	Tassert(t, crm.Repeat == 3, "crm repeat %v", crm.Repeat)
+	Tassert(t, crm.FinRate == .08, "crm finrate %v", crm.FinRate)
+	Tassert(t, erp.Desc == "erp renewal", "erp desc %q", erp.Desc)
+	Tassert(t, erp.Period.Cash == -12000, "erp cash %v", erp.Period.Cash)
+	Tassert(t, erp.Repeat == 5, "erp repeat %v", erp.Repeat)
+	Tassert(t, erp.Period.Duration.Hours() == 365*24, "erp days %v", erp.Period.Duration)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := FromYAML([]byte("templates:\n  a:\n    extends: b\n  b:\n    extends: a\nfoo:\n  extends: a\n"))
+	Tassert(t, err != nil && strings.Contains(err.Error(), "cycle"), "expected cycle error, got %v", err)
+	_, err = FromYAML([]byte("foo:\n  extends: nope\n"))
+	Tassert(t, err != nil && strings.Contains(err.Error(), "no such template"), "expected missing template error, got %v", err)
+}
+
+func TestTemplateZeroOverride(t *testing.T) {
+	buf := []byte(`
+templates:
+  choice:
+    decision: true
+    finrate: .08
+    rerate: .05
+    days: 30
+pick:
+  extends: choice
+  decision: false
+  finrate: 0
+  paths:
+    leaf: 1
+leaf:
+  extends: choice
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	pick := roots[0]
+	Tassert(t, !pick.Decision, "pick decision %v", pick.Decision)
+	Tassert(t, pick.FinRate == 0, "pick finrate %v", pick.FinRate)
+	Tassert(t, pick.ReRate == .05, "pick rerate %v", pick.ReRate)
+	leaf := pick.Hyperedges[0].Children[0]
+	Tassert(t, leaf.Decision, "leaf decision %v", leaf.Decision)
+	Tassert(t, leaf.FinRate == .08, "leaf finrate %v", leaf.FinRate)
+}
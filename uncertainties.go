@@ -0,0 +1,171 @@
+package tree
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"gopkg.in/yaml.v2"
+)
+
+// An uncertainty that shows up in more than one place in the tree
+// can be declared once, in the model-level `uncertainties:` section,
+// and referred to from path probabilities as `name.outcome`:
+//
+//	uncertainties:
+//	  demand: {high: .6, low: rest}
+//	big:
+//	  paths:
+//	    big-high: demand.high
+//	    big-low: demand.low
+//	small:
+//	  paths:
+//	    small-high: demand.high
+//	    small-low: demand.low
+//
+// A node's `uncertainties:` list can also name a declared uncertainty
+// instead of spelling out its outcomes.  Either way the hyperedges
+// are labeled with the outcomes they stand for, so that analysis
+// tools can tell that `big-high` and `small-high` are the same event;
+// see Events.
+
+// UnmarshalYAML accepts either a list of `name: {outcome: prob, ...}`
+// entries or a single map of them.
+func (us *Uncertainties) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var list []Uncertainty
+	if unmarshal(&list) == nil {
+		*us = list
+		return
+	}
+	var entries yaml.MapSlice
+	err = unmarshal(&entries)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		var u Uncertainty
+		u, err = uncertaintyFrom(entry)
+		if err != nil {
+			return
+		}
+		*us = append(*us, u)
+	}
+	return
+}
+
+// uncertainty returns the model-level uncertainty with the given name.
+func (m *Model) uncertainty(name string) (u Uncertainty, ok bool) {
+	for _, u = range m.Uncertainties {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return
+}
+
+// resolveOutcomeRefs checks the model-level uncertainties and tests,
+// and replaces `name.outcome` (and `name.outcome | test.signal, ...`)
+// in the working nodes' path probabilities with the probability.
+func (m *Model) resolveOutcomeRefs() (err error) {
+	r, err := m.newEventResolver()
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, name := range r.names() {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	ref := Spf(`(%s)\.(\w+)\b`, strings.Join(names, "|"))
+	refRe := regexp.MustCompile(ref)
+	re := regexp.MustCompile(Spf(`(^|[^\w.])%s((?:\s*\|\s*%s)(?:\s*,\s*%s)*)?`, ref, ref, ref))
+
+	for _, name := range m.nodeNames(func(node Node) bool { return len(node.Paths) > 0 }) {
+		node := m.nodes[name]
+		paths := make(Paths, len(node.Paths))
+		for pathKey, expr := range node.Paths {
+			outcomes := make(map[string]string)
+			expr = re.ReplaceAllStringFunc(expr, func(s string) string {
+				match := re.FindStringSubmatch(s)
+				e := event{match[2], match[3]}
+				var given []event
+				for _, g := range refRe.FindAllStringSubmatch(match[4], -1) {
+					given = append(given, event{g[1], g[2]})
+				}
+				if _, err := r.about(e); err != nil && len(given) == 0 && isRefField(e.outcome) {
+					// probably a cross-node reference, e.g. big-lowavg.cash
+					return s
+				}
+				prob, perr := r.prob(e, given)
+				if perr != nil {
+					err = fmt.Errorf("%s: paths: %v", name, perr)
+					return s
+				}
+				if outcomes[e.name] == "" {
+					outcomes[e.name] = e.outcome
+				} else {
+					outcomes[e.name] += "|" + e.outcome
+				}
+				return match[1] + "(" + prob + ")"
+			})
+			if err != nil {
+				return
+			}
+			paths[pathKey] = expr
+			m.setOutcomes(name, pathKey, outcomes)
+		}
+		node.Paths = paths
+		m.nodes[name] = node
+	}
+	return
+}
+
+// setOutcomes records the outcomes the given path of the named node
+// stands for.
+func (m *Model) setOutcomes(name, pathKey string, event map[string]string) {
+	if len(event) == 0 {
+		return
+	}
+	if m.outcomes == nil {
+		m.outcomes = make(map[string]map[string]string)
+	}
+	m.outcomes[name+"\x00"+pathKey] = event
+}
+
+// Events groups the hyperedges in the trees by the uncertainties they
+// are outcomes of, so that e.g. sensitivity analysis can treat them
+// as one event.
+func Events(roots []*Ast) (events map[string][]*Hyperedge) {
+	events = make(map[string][]*Hyperedge)
+	var walk func(node *Ast)
+	walk = func(node *Ast) {
+		for _, hedge := range node.Hyperedges {
+			for u := range hedge.Outcomes {
+				events[u] = append(events[u], hedge)
+			}
+			for _, child := range hedge.Children {
+				walk(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	return
+}
+
+// isRefField reports whether s is a field that can be used in a
+// cross-node reference.
+func isRefField(s string) bool {
+	for _, f := range refFields {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
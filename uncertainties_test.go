@@ -0,0 +1,56 @@
+package tree
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSharedUncertainties(t *testing.T) {
+	data, err := testFS.ReadFile("examples/hbr.yaml")
+	Tassert(t, err == nil, "%v", err)
+	roots, err := FromYAML(data)
+	Tassert(t, err == nil, "%v", err)
+
+	events := Events(roots)
+	Tassert(t, len(events["initial_demand"]) == 5, "initial_demand edges %d", len(events["initial_demand"]))
+	Tassert(t, len(events["later_demand"]) == 4, "later_demand edges %d", len(events["later_demand"]))
+	for _, hedge := range events["initial_demand"] {
+		switch hedge.Path {
+		case "small-highinit":
+			Tassert(t, hedge.Outcomes["initial_demand"] == "high_avg|high_initial", "outcomes %v", hedge.Outcomes)
+			Tassert(t, math.Abs(hedge.Prob-.7) < 1e-9, "prob %v", hedge.Prob)
+		case "big-lowavg", "small-lowinit":
+			Tassert(t, hedge.Outcomes["initial_demand"] == "low", "outcomes %v", hedge.Outcomes)
+		}
+	}
+}
+
+func TestUncertaintyRefs(t *testing.T) {
+	buf := []byte(`
+uncertainties:
+  - demand: {high: .6, low: rest}
+launch:
+  uncertainties: [demand]
+  each:
+    cash: 1M * demand_high
+`)
+	roots, err := FromYAML(buf)
+	Tassert(t, err == nil, "%v", err)
+	hedges := roots[0].Hyperedges
+	Tassert(t, len(hedges) == 2, "hyperedges %d", len(hedges))
+	Tassert(t, hedges[0].Path == "launch/high" && hedges[0].Outcomes["demand"] == "high", "%s %v", hedges[0].Path, hedges[0].Outcomes)
+	Tassert(t, math.Abs(hedges[1].Prob-.4) < 1e-9, "low prob %v", hedges[1].Prob)
+
+	cases := map[string]string{
+		"uncertainties:\n  d: {x: .5, y: .5}\na:\n  paths:\n    b: d.z\n": "d has no outcome z",
+		"a:\n  uncertainties: [nope]\n":                                   "no such uncertainty: nope",
+		"uncertainties:\n  d: {x: .5, x: .5}\n":                           "duplicate outcome",
+	}
+	for yml, want := range cases {
+		_, err := FromYAML([]byte(yml))
+		Tassert(t, err != nil && strings.Contains(err.Error(), want), "%q: want %q, got %v", yml, want, err)
+	}
+}